@@ -0,0 +1,208 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dumpName = "director.sql"
+
+// Write archives the files held in stateDir into dst,
+// along with the director database dump when given
+func Write(dst string, stateDir string, dump []byte) error {
+	files, err := ioutil.ReadDir(stateDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %s", stateDir, err)
+	}
+
+	f, err := create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %s", dst, err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	writer := tar.NewWriter(gz)
+
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(stateDir, fi.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", fi.Name(), err)
+		}
+
+		err = writeEntry(writer, "bosh/"+fi.Name(), fi.Mode(), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dump != nil {
+		err = writeEntry(writer, dumpName, 0600, dump)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// Read extracts the files archived by Write into
+// stateDir and returns the database dump, if any
+func Read(src string, stateDir string) ([]byte, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", src, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a director backup: %s", src, err)
+	}
+	defer gz.Close()
+
+	err = os.MkdirAll(stateDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dump   []byte
+		reader = tar.NewReader(gz)
+	)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return dump, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", src, err)
+		}
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", src, err)
+		}
+
+		if header.Name == dumpName {
+			dump = data
+			continue
+		}
+
+		name := strings.TrimPrefix(header.Name, "bosh/")
+		if name == header.Name || name != filepath.Base(name) {
+			return nil, fmt.Errorf("%s is not a director backup: unexpected entry '%s'", src, header.Name)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(stateDir, name), data, os.FileMode(header.Mode))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Rotate copies file into dir under a timestamped
+// name, keeping only the most recent copies
+func Rotate(file string, dir string, keep int) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	name := fmt.Sprintf("%s-%s%s", base, time.Now().Format("20060102T150405"), ext)
+
+	f, err := create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, base+"-*"+ext))
+	if err != nil {
+		return err
+	}
+
+	// timestamps sort lexically, oldest first
+	sort.Strings(backups)
+	for len(backups) > keep {
+		err = os.RemoveAll(backups[0])
+		if err != nil {
+			return err
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// create opens dst for writing by the owner only, as backups
+// carry the credentials of the director, which also goes
+// for a file that was there before with a looser mode
+func create(dst string) (*os.File, error) {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Chmod(0600)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func writeEntry(writer *tar.Writer, name string, mode os.FileMode, data []byte) error {
+	err := writer.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(mode.Perm()),
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
@@ -0,0 +1,208 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/lit"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// ciCmd represents the ci command
+var ciCmd = &cobra.Command{
+	Use:   "ci",
+	Short: "Run commands against throwaway BOSH Lit environments",
+}
+
+var ciRunCmd = &cobra.Command{
+	Use:   "run -- <command> [args...]",
+	Short: "Run a command against a throwaway BOSH Lit environment",
+	Long: `Brings up an ephemeral BOSH Lit environment in a temporary directory and
+runs the given command with the variables of "blt env" exported, along with
+BLT_HOME so that blt commands target the ephemeral environment. The logs of the
+environment are collected when either fails, and the environment is torn down
+and deleted regardless. The exit code is that of the command.
+
+This is the same as "blt up --ephemeral" followed by "blt down" in the
+ephemeral environment, see "blt up --help".`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		code, err := performCIRun(args)
+		if err != nil {
+			fmt.Printf(boldRed.Sprint("Error")+"\n%s.\n", err)
+		}
+
+		if err != nil && code == 0 {
+			code = 1
+		}
+
+		os.Exit(code)
+	},
+}
+
+var (
+	ciLogsDir         string
+	ciPresetName      string
+	ciUploadStemcells bool
+)
+
+func init() {
+	rootCmd.AddCommand(ciCmd)
+	ciCmd.AddCommand(ciRunCmd)
+
+	ciRunCmd.Flags().StringVar(&ciLogsDir, "logs", "blt-logs", "Directory to collect the logs of the environment into on failure")
+	ciRunCmd.Flags().StringVarP(&ciPresetName, "preset", "p", "", `Preset to bring the environment up with, see "blt presets" (default is the last one used)`)
+	ciRunCmd.Flags().BoolVar(&ciUploadStemcells, "upload-stemcells", false, `Upload stemcells cached with "blt stemcell add"`)
+}
+
+func performCIRun(args []string) (int, error) {
+	env, name, err := newEphemeralEnvironment(ciPresetName)
+	if err != nil {
+		return 1, err
+	}
+
+	// interrupts cancel bringing the environment up, are passed on to
+	// the command after that, and must not keep the teardown from running
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	code, err := runInEnvironment(env, lit.UpOptions{Preset: name, UploadStemcells: ciUploadStemcells}, args, signals)
+	if err != nil || code != 0 {
+		collectLogs(env)
+	}
+
+	boldWhite.Print("Removing Environment...   ")
+	removeErr := env.Remove(context.Background())
+	if removeErr != nil {
+		boldRed.Println("Failed")
+	} else {
+		boldGreen.Println("Success")
+	}
+
+	if err == nil {
+		err = removeErr
+	}
+
+	return code, err
+}
+
+func runInEnvironment(env *lit.Environment, opts lit.UpOptions, args []string, signals chan os.Signal) (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	upDone := make(chan bool)
+	stopped := make(chan bool)
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-upDone:
+		case <-signals:
+			cancel()
+		}
+	}()
+
+	err := env.Up(ctx, opts)
+	close(upDone)
+	<-stopped
+
+	stopIndeterminateProgressAnimation()
+	if err == nil && ctx.Err() != nil {
+		err = errors.New("interrupted while bringing the environment up")
+	}
+
+	if err != nil {
+		return 1, err
+	}
+
+	command := exec.Command(args[0], args[1:]...)
+	command.Env = append(os.Environ(), "BLT_HOME="+filepath.Dir(env.HomeDir()))
+	for _, v := range env.Env() {
+		command.Env = append(command.Env, v.Key+"="+v.Value)
+	}
+
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	// only the signals that arrive while the command runs are its own
+	drainSignals(signals)
+
+	err = command.Start()
+	if err != nil {
+		return 1, err
+	}
+
+	done := make(chan bool)
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-signals:
+				command.Process.Signal(s)
+			}
+		}
+	}()
+
+	err = command.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// commands killed by a signal have no exit code
+		if exitErr.ExitCode() < 0 {
+			return 1, nil
+		}
+
+		return exitErr.ExitCode(), nil
+	}
+
+	if err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+func drainSignals(signals chan os.Signal) {
+	for {
+		select {
+		case <-signals:
+		default:
+			return
+		}
+	}
+}
+
+func collectLogs(env *lit.Environment) {
+	files, err := env.CollectLogs(context.Background(), ciLogsDir)
+	for _, f := range files {
+		fmt.Printf("Collected %s\n", f)
+	}
+
+	if err != nil {
+		fmt.Printf("%s %s\n", boldYellow.Sprint("Note:"), err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+)
+
+// configsCmd represents the configs command
+var configsCmd = &cobra.Command{
+	Use:   "configs",
+	Short: "Manage the cloud, runtime and cpi configs of your BOSH director",
+	Long: fmt.Sprintf(`Configs placed in the "configs" directory of your blt home are
+reconciled against your BOSH director on every "blt up". They are
+organized by type, and named after their file:
+
+    $HOME/.blt/configs/cloud/<name>.yml
+    $HOME/.blt/configs/runtime/<name>.yml
+    $HOME/.blt/configs/cpi/<name>.yml
+
+For example, to replace the default cloud-config:
+
+$ cp cloud-config.yml $HOME/.blt/configs/cloud/default.yml
+$ blt configs diff
+$ blt configs apply
+
+%s If no default cloud-config is declared, the one from your preset
+is used. Otherwise the pre-configured one is uploaded only when the
+director does not already have one.
+`, boldWhite.Sprint("Note:")),
+}
+
+var configsDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the difference between declared configs and your BOSH director",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performConfigsDiff()
+		expectNoError(err)
+	},
+}
+
+var configsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Upload declared configs that differ from your BOSH director",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performConfigsApply()
+		expectNoError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configsCmd)
+	configsCmd.AddCommand(configsDiffCmd)
+	configsCmd.AddCommand(configsApplyCmd)
+
+	addWaitFlag(configsApplyCmd)
+}
+
+func performConfigsDiff() error {
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	configs, err := environment().DesiredConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range configs {
+		diff, err := environment().DiffConfig(c)
+		if err != nil {
+			return err
+		}
+
+		boldWhite.Println(c)
+		if diff == "" {
+			fmt.Println("No changes")
+		} else {
+			fmt.Println(diff)
+		}
+	}
+
+	return nil
+}
+
+func performConfigsApply() error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	configs, err := environment().DesiredConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range configs {
+		boldWhite.Printf("Applying %s...  ", c)
+
+		changed, err := environment().ReconcileConfig(c)
+		if err != nil {
+			boldRed.Println("Failed")
+			return err
+		}
+
+		if changed {
+			boldGreen.Println("Updated")
+		} else {
+			boldGreen.Println("Up-to-date")
+		}
+	}
+
+	return nil
+}
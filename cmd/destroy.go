@@ -15,11 +15,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"github.com/aemengo/blt/path"
 	"github.com/aemengo/blt/vm"
 	"github.com/spf13/cobra"
-	"os"
 )
 
 // destroyCmd represents the destroy command
@@ -48,10 +47,11 @@ func init() {
 	// destroyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	destroyCmd.Flags().BoolVarP(&ignoreConfirmation, "force", "f", false, "Force deletion without confirmation")
+	addWaitFlag(destroyCmd)
 }
 
 func performDestroy() error {
-	status := vm.GetStatus(bltHomeDir)
+	status, _ := environment().Status(context.Background())
 	if status != vm.VMStatusStopped {
 		return fmt.Errorf("your VM must be stopped before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
 	}
@@ -61,5 +61,9 @@ func performDestroy() error {
 		return nil
 	}
 
-	return os.RemoveAll(path.StateDir(bltHomeDir))
+	if environment().Ephemeral() {
+		return environment().Remove(context.Background())
+	}
+
+	return environment().Destroy(context.Background())
 }
\ No newline at end of file
@@ -0,0 +1,193 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aemengo/blt/backup"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+	"os/exec"
+	"strings"
+)
+
+// directorCmd represents the director command
+var directorCmd = &cobra.Command{
+	Use:   "director",
+	Short: "Back up and restore the state of your BOSH director",
+	Long: fmt.Sprintf(`Back up and restore the state of your BOSH director.
+
+A backup holds the "state.json" and "creds.yml" of your BOSH director, along
+with a dump of its database when the VM is running. In addition, the last 5
+copies of "state.json" are kept in "$HOME/.blt/state/backups", one before
+every %s.
+`, boldWhite.Sprint("blt up")),
+}
+
+var directorBackupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Archive the state of your BOSH director into a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performDirectorBackup(args[0])
+		expectNoError(err)
+	},
+}
+
+var directorRestoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Restore the state of your BOSH director from a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performDirectorRestore(args[0])
+		expectNoError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(directorCmd)
+	directorCmd.AddCommand(directorBackupCmd)
+	directorCmd.AddCommand(directorRestoreCmd)
+
+	directorRestoreCmd.Flags().BoolVarP(&ignoreConfirmation, "force", "f", false, "Force restoration without confirmation")
+	addWaitFlag(directorBackupCmd)
+	addWaitFlag(directorRestoreCmd)
+}
+
+func performDirectorBackup(file string) error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var dump []byte
+
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status == vm.VMStatusRunning {
+		boldWhite.Print("Dumping Director Database...  ")
+
+		var err error
+		dump, err = dumpDirectorDatabase()
+		if err != nil {
+			boldRed.Println("Failed")
+			return err
+		}
+		boldGreen.Println("Success")
+	} else {
+		fmt.Printf("%s your VM is currently %s, the director database will not be included.\n", boldYellow.Sprint("Note:"), boldWhite.Sprint(status))
+	}
+
+	boldWhite.Print("Archiving Director State...  ")
+	err = backup.Write(file, path.BoshStatePath(bltHomeDir), dump)
+	if err != nil {
+		boldRed.Println("Failed")
+		return err
+	}
+	boldGreen.Println("Success")
+
+	return nil
+}
+
+func performDirectorRestore(file string) error {
+	if !ignoreConfirmation && !askForConfirmation("Do you really want to overwrite the state of your BOSH director?", 3) {
+		fmt.Println("Aborting...")
+		return nil
+	}
+
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	boldWhite.Print("Restoring Director State...  ")
+	dump, err := backup.Read(file, path.BoshStatePath(bltHomeDir))
+	if err != nil {
+		boldRed.Println("Failed")
+		return err
+	}
+	boldGreen.Println("Success")
+
+	if dump == nil {
+		return nil
+	}
+
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		fmt.Printf("%s your VM is currently %s, the director database was not restored.\n", boldYellow.Sprint("Note:"), boldWhite.Sprint(status))
+		return nil
+	}
+
+	boldWhite.Print("Restoring Director Database...  ")
+	err = restoreDirectorDatabase(dump)
+	if err != nil {
+		boldRed.Println("Failed")
+		return err
+	}
+	boldGreen.Println("Success")
+
+	return nil
+}
+
+func dumpDirectorDatabase() ([]byte, error) {
+	script, err := postgresScript("pg_dump --clean --if-exists -h 127.0.0.1 -U postgres bosh")
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	command := environment().JumpboxCommand(script)
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump the director database: %s: %s", err, stderr.String())
+	}
+
+	return output, nil
+}
+
+func restoreDirectorDatabase(dump []byte) error {
+	script, err := postgresScript("psql -q -h 127.0.0.1 -U postgres bosh")
+	if err != nil {
+		return err
+	}
+
+	command := environment().JumpboxCommand(script + " && sudo /var/vcap/bosh/bin/monit restart director")
+	command.Stdin = bytes.NewReader(dump)
+
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restore the director database: %s: %s", err, output)
+	}
+
+	return nil
+}
+
+// postgresScript prefixes the given postgres client invocation with
+// the location of the binaries and credentials of the director
+func postgresScript(invocation string) (string, error) {
+	output, err := exec.Command(environment().ToolPath("bosh"), "int", path.BoshCredsPath(bltHomeDir), "--path", "/postgres_password").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the director database password: %s: %s", err, output)
+	}
+
+	return fmt.Sprintf(`PGPASSWORD='%s' "$(ls -d /var/vcap/packages/postgres*/bin | tail -1)"/%s`,
+		strings.TrimSpace(string(output)), invocation), nil
+}
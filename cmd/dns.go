@@ -0,0 +1,297 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/director"
+	"github.com/aemengo/blt/dns"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Resolve names of BOSH instances from your machine",
+	Long: fmt.Sprintf(`Resolve names of BOSH instances from your machine.
+
+"blt dns serve" answers queries for names under the suffix configured
+in $HOME/.blt/config.yml (blt.local by default) with the IPs of BOSH instances:
+
+    director.blt.local                  the director
+    router.cf.blt.local                 every instance of a group
+    0.router.cf.blt.local               an instance by index or id
+
+Additional records, including wildcards, point to an IP or an instance:
+
+dns:
+  records:
+    "*.cf.blt.local": cf/router
+    uaa.cf.blt.local: 10.244.0.35
+
+Queries for any other name are relayed to the nameserver of your machine,
+or to dns.upstream. For your machine to send queries for the suffix to the
+resolver, run:
+
+$ %s
+`, boldWhite.Sprint("blt dns install")),
+}
+
+var dnsServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the resolver in the foreground",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performDNSServe()
+		expectNoError(err)
+	},
+}
+
+var dnsInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Send queries for the suffix to the resolver",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performDNSInstall()
+		expectNoError(err)
+	},
+}
+
+var dnsUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: `Undo "blt dns install"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performDNSUninstall()
+		expectNoError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+	dnsCmd.AddCommand(dnsServeCmd)
+	dnsCmd.AddCommand(dnsInstallCmd)
+	dnsCmd.AddCommand(dnsUninstallCmd)
+}
+
+func performDNSServe() error {
+	upstream := dnsConfig.Upstream
+	if upstream == "" {
+		var err error
+		upstream, err = dns.SystemUpstream()
+		if err != nil {
+			return err
+		}
+	}
+
+	r := &instanceResolver{}
+
+	server := &dns.Server{
+		Suffix:   dnsConfig.Suffix,
+		Upstream: upstream,
+		Lookup:   r.lookup,
+		Log: func(line string) {
+			logChange(boldWhite.Sprint(">"), line)
+		},
+	}
+
+	logChange(boldWhite.Sprint("*"), fmt.Sprintf("answering for %s on %s, relaying the rest to %s", dnsConfig.Suffix, dnsConfig.Listen, upstream))
+	return server.ListenAndServe(dnsConfig.Listen)
+}
+
+func performDNSInstall() error {
+	err := dns.CheckResolver(dnsConfig.Listen)
+	if err != nil {
+		return err
+	}
+
+	installer, err := dns.ResolverInstaller(dnsConfig.Suffix, dnsConfig.Listen)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile("", "blt-dns-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(installer.Contents)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+
+	commands := []string{
+		fmt.Sprintf("mkdir -p %s", filepath.Dir(installer.Path)),
+		fmt.Sprintf("cp %s %s", tmpFile.Name(), installer.Path),
+		fmt.Sprintf("chmod 0644 %s", installer.Path),
+	}
+
+	if installer.Enable != "" {
+		commands = append(commands, installer.Enable)
+	}
+
+	err = runAsRoot(commands)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Queries for %s are now sent to %s, which %s answers\n",
+		boldWhite.Sprint(dnsConfig.Suffix), dnsConfig.Listen, boldWhite.Sprint("blt dns serve"))
+	return nil
+}
+
+func performDNSUninstall() error {
+	installer, err := dns.ResolverInstaller(dnsConfig.Suffix, dnsConfig.Listen)
+	if err != nil {
+		return err
+	}
+
+	if !exists(installer.Path) {
+		return nil
+	}
+
+	commands := []string{"rm -f " + installer.Path}
+	if installer.Disable != "" {
+		commands = append(commands, installer.Disable)
+	}
+
+	return runAsRoot(commands)
+}
+
+// instanceResolver looks up names under the suffix, caching
+// what it learns from the director for a few seconds
+type instanceResolver struct {
+	mutex       sync.Mutex
+	client      *director.Client
+	fetchedAt   time.Time
+	deployments map[string][]director.VM
+}
+
+func (r *instanceResolver) lookup(name string) ([]net.IP, error) {
+	if value, ok := dnsConfig.Records[name]; ok {
+		return r.resolve(value)
+	}
+
+	relative := strings.TrimSuffix(name, "."+dnsConfig.Suffix)
+	labels := strings.Split(relative, ".")
+
+	switch {
+	case relative == "director":
+		return r.resolve(network.DirectorIP)
+	case len(labels) == 2:
+		ips, err := r.resolve(labels[1] + "/" + labels[0])
+		if err != nil || len(ips) > 0 {
+			return ips, err
+		}
+	case len(labels) == 3:
+		ips, err := r.resolve(labels[2] + "/" + labels[1] + "/" + labels[0])
+		if err != nil || len(ips) > 0 {
+			return ips, err
+		}
+	}
+
+	nameLabels := strings.Split(name, ".")
+	for i := 1; i < len(nameLabels); i++ {
+		if value, ok := dnsConfig.Records["*."+strings.Join(nameLabels[i:], ".")]; ok {
+			return r.resolve(value)
+		}
+	}
+
+	return nil, nil
+}
+
+// resolve returns the addresses of a record value,
+// which is either an IP or deployment/group[/index]
+func (r *instanceResolver) resolve(value string) ([]net.IP, error) {
+	if ip := net.ParseIP(value); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return nil, nil
+	}
+
+	vms, err := r.vms(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, v := range vms {
+		if !v.Matches(parts[1]) {
+			continue
+		}
+
+		for _, ip := range v.IPs {
+			if addr := net.ParseIP(ip); addr != nil {
+				ips = append(ips, addr)
+			}
+		}
+	}
+
+	return ips, nil
+}
+
+func (r *instanceResolver) vms(deployment string) ([]director.VM, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.fetchedAt) > 5*time.Second {
+		r.deployments = nil
+	}
+
+	if r.deployments == nil {
+		if r.client == nil {
+			client, err := environment().DirectorClient()
+			if err != nil {
+				return nil, err
+			}
+
+			r.client = client
+		}
+
+		deployments, err := r.client.Deployments()
+		if err != nil {
+			return nil, err
+		}
+
+		r.deployments = map[string][]director.VM{}
+		for _, d := range deployments {
+			r.deployments[d.Name] = nil
+		}
+
+		r.fetchedAt = time.Now()
+	}
+
+	vms, ok := r.deployments[deployment]
+	if !ok || vms != nil {
+		return vms, nil
+	}
+
+	vms, err := r.client.VMs(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	r.deployments[deployment] = vms
+	return vms, nil
+}
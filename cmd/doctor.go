@@ -0,0 +1,386 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aemengo/blt/director"
+	"github.com/aemengo/blt/hostnet"
+	"github.com/aemengo/blt/lit"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/versions"
+	"github.com/aemengo/blt/vm"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems with your BOSH Lit environment",
+	Long: `Diagnose common problems with your BOSH Lit environment.
+
+Every check reports whether it passed, deserves a warning or failed,
+along with a hint on how to remedy it. The command exits with a non-zero
+status when any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		results := runDoctorChecks()
+
+		if doctorJSON {
+			presentDoctorJSON(results)
+		} else {
+			presentDoctorResults(results)
+		}
+
+		for _, r := range results {
+			if r.Status == checkFail {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+var doctorJSON bool
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the results as JSON")
+}
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+func runDoctorChecks() []checkResult {
+	checkErr := vm.Check(context.Background(), bltHomeDir)
+
+	status := vm.VMStatusRunning
+	switch vm.Cause(checkErr) {
+	case nil:
+	case vm.ErrVMStopped:
+		status = vm.VMStatusStopped
+	default:
+		status = vm.VMStatusUnresponsive
+	}
+
+	var results []checkResult
+
+	constraints, err := versions.LoadConstraints(path.DependenciesPath(bltHomeDir))
+	if err != nil {
+		results = append(results, checkResult{
+			Name:   "dependencies",
+			Status: checkFail,
+			Detail: err.Error(),
+			Hint:   fmt.Sprintf(`remove %s and run "blt up" to download the assets again`, path.AssetVersionPath(bltHomeDir)),
+		})
+	}
+
+	for _, d := range environment().RequiredDependencies() {
+		results = append(results, checkDependency(d, constraints))
+	}
+
+	return append(results,
+		checkAssets(),
+		checkDiskSpace(),
+		checkPidFile(status),
+		checkPort(status, checkErr, vm.ErrCPIUnreachable, 9999, "CPI"),
+		checkPort(status, checkErr, vm.ErrVPNKitUnreachable, 9998, "vpnkit-manager"),
+		checkLoopbackAlias(),
+		checkDirectorInfo(status),
+	)
+}
+
+func checkDependency(d lit.Dependency, constraints map[string]versions.Constraint) checkResult {
+	result := checkResult{Name: d.Name}
+
+	hint := "install " + d.Name
+	if d.Site != "" {
+		hint += " from " + d.Site
+	}
+
+	found, err := environment().Inspect(d)
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = "not found"
+		result.Hint = hint
+		return result
+	}
+
+	result.Status = checkPass
+	result.Detail = "found"
+	if found != nil {
+		result.Detail = "found " + found.String()
+	}
+
+	c, ok := constraints[d.Name]
+	if !ok {
+		return result
+	}
+
+	result.Detail += ", requires " + c.String()
+	if found == nil || !c.Allows(found) {
+		result.Status = checkFail
+		result.Hint = hint + ", in a supported version"
+	}
+
+	return result
+}
+
+func checkAssets() checkResult {
+	result := checkResult{Name: "assets"}
+
+	if !exists(path.AssetVersionPath(bltHomeDir)) {
+		result.Status = checkWarn
+		result.Detail = "not downloaded yet"
+		result.Hint = `they are downloaded by "blt up"`
+		return result
+	}
+
+	required := []string{
+		path.EFIisoPath(bltHomeDir),
+		filepath.Join(path.AssetDir(bltHomeDir), "vpnkit"),
+		filepath.Join(path.BoshDeploymentDir(bltHomeDir), "bosh.yml"),
+		filepath.Join(path.BoshDeploymentDir(bltHomeDir), "jumpbox-user.yml"),
+		filepath.Join(path.BoshOperationsDir(bltHomeDir), "runc-cpi.yml"),
+	}
+
+	for _, file := range required {
+		info, err := os.Stat(file)
+		if err != nil || info.Size() == 0 {
+			result.Status = checkFail
+			result.Detail = fmt.Sprintf("%s is missing or empty", file)
+			result.Hint = fmt.Sprintf(`remove %s and run "blt up" to download them again`, path.AssetVersionPath(bltHomeDir))
+			return result
+		}
+	}
+
+	if environment().NeedsUpdates() {
+		result.Status = checkWarn
+		result.Detail = "outdated for this version of blt"
+		result.Hint = `they are updated by "blt up"`
+		return result
+	}
+
+	contents, _ := ioutil.ReadFile(path.AssetVersionPath(bltHomeDir))
+	result.Status = checkPass
+	result.Detail = "version " + strings.TrimSpace(string(contents))
+	return result
+}
+
+func checkDiskSpace() checkResult {
+	result := checkResult{Name: "disk space"}
+
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(bltHomeDir, &stat)
+	if err != nil {
+		result.Status = checkWarn
+		result.Detail = fmt.Sprintf("failed to inspect %s: %s", bltHomeDir, err)
+		return result
+	}
+
+	free := stat.Bavail * uint64(stat.Bsize)
+	result.Detail = fmt.Sprintf("%s free for %s", humanize.Bytes(free), bltHomeDir)
+
+	// the VM disk grows on demand, up to the size it was given
+	diskSize := uint64(40)
+	if p, err := environment().CurrentPreset(); err == nil {
+		if size, err := strconv.ParseUint(p.Disk, 10, 64); err == nil {
+			diskSize = size
+		}
+	}
+
+	switch {
+	case free < 2*humanize.GByte:
+		result.Status = checkFail
+		result.Hint = `free up space on your machine, or reclaim it from the VM with "blt prune"`
+	case free < diskSize*humanize.GByte:
+		result.Status = checkWarn
+		result.Hint = fmt.Sprintf("the VM disk may grow up to %dGB, consider freeing up space", diskSize)
+	default:
+		result.Status = checkPass
+	}
+
+	return result
+}
+
+func checkPidFile(status vm.Status) checkResult {
+	result := checkResult{Name: "hypervisor"}
+
+	data, err := ioutil.ReadFile(path.Pidpath(bltHomeDir))
+	if os.IsNotExist(err) {
+		result.Status = checkPass
+		result.Detail = "not running"
+		return result
+	}
+
+	switch status {
+	case vm.VMStatusRunning:
+		result.Status = checkPass
+		result.Detail = "running with pid " + strings.TrimSpace(string(data))
+	case vm.VMStatusUnresponsive:
+		result.Status = checkFail
+		result.Detail = "running with pid " + strings.TrimSpace(string(data)) + ", but unresponsive"
+		result.Hint = `restart it with "blt down" and "blt up"`
+	default:
+		result.Status = checkWarn
+		result.Detail = fmt.Sprintf("stale pid file %s, its hypervisor is gone", path.Pidpath(bltHomeDir))
+		result.Hint = `it is cleaned up by "blt up", or by "blt down --force" along with any orphaned hypervisor`
+	}
+
+	return result
+}
+
+func checkPort(status vm.Status, checkErr error, unreachable error, port int, purpose string) checkResult {
+	result := checkResult{Name: fmt.Sprintf("port %d", port)}
+
+	if vm.Cause(checkErr) == unreachable {
+		result.Status = checkFail
+		result.Detail = checkErr.Error()
+		result.Hint = `restart the VM with "blt down" and "blt up", or raise --timeout if it is just slow`
+		return result
+	}
+
+	if status != vm.VMStatusStopped {
+		result.Status = checkPass
+		result.Detail = "in use by the " + purpose
+		return result
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = "in use by another process"
+		result.Hint = fmt.Sprintf(`the %s needs it, find the process with "lsof -i :%d"`, purpose, port)
+		return result
+	}
+	l.Close()
+
+	result.Status = checkPass
+	result.Detail = "available"
+	return result
+}
+
+func checkLoopbackAlias() checkResult {
+	result := checkResult{Name: "loopback aliases"}
+
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		result.Status = checkWarn
+		result.Detail = err.Error()
+		return result
+	}
+
+	var missing []string
+	for _, ip := range aliasedIPs() {
+		if !assigned[ip] {
+			missing = append(missing, ip)
+		}
+	}
+
+	switch {
+	case len(missing) == 0:
+		result.Status = checkPass
+		result.Detail = "assigned"
+		return result
+	case missing[0] == network.DirectorIP:
+		result.Status = checkFail
+	default:
+		result.Status = checkWarn
+	}
+
+	result.Detail = strings.Join(missing, ", ") + " not assigned"
+	result.Hint = `run "blt net setup"`
+	return result
+}
+
+func checkDirectorInfo(status vm.Status) checkResult {
+	result := checkResult{Name: "director"}
+
+	if status != vm.VMStatusRunning {
+		result.Status = checkWarn
+		result.Detail = "VM is " + strings.ToLower(status.String())
+		result.Hint = `start it with "blt up"`
+		return result
+	}
+
+	info, err := fetchDirectorInfo()
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = err.Error()
+		result.Hint = `check "blt net status", or deploy the director again with "blt down" and "blt up"`
+		return result
+	}
+
+	result.Status = checkPass
+	result.Detail = fmt.Sprintf("%s %s at %s", info.Name, info.Version, network.DirectorIP)
+	return result
+}
+
+func fetchDirectorInfo() (director.Info, error) {
+	client, err := environment().DirectorClient()
+	if err != nil {
+		return director.Info{}, err
+	}
+
+	return client.Info()
+}
+
+func presentDoctorResults(results []checkResult) {
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+
+	for _, r := range results {
+		label := boldGreen.Sprint("pass")
+		switch r.Status {
+		case checkWarn:
+			label = boldYellow.Sprint("warn")
+		case checkFail:
+			label = boldRed.Sprint("fail")
+		}
+
+		fmt.Printf("[%s] %-*s  %s\n", label, width, r.Name, r.Detail)
+		if r.Hint != "" {
+			fmt.Printf("       %-*s  %s\n", width, "", r.Hint)
+		}
+	}
+}
+
+func presentDoctorJSON(results []checkResult) {
+	data, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(data))
+}
@@ -15,7 +15,8 @@
 package cmd
 
 import (
-	"github.com/aemengo/blt/vm"
+	"context"
+	"github.com/aemengo/blt/lit"
 	"github.com/spf13/cobra"
 )
 
@@ -24,13 +25,19 @@ var downCmd = &cobra.Command{
 	Use:   "down",
 	Short: "Spin down your local BOSH Lit VM",
 	Run: func(cmd *cobra.Command, args []string) {
-		vm.Stop(bltHomeDir)
+		err := performDown()
+		expectNoError(err)
 	},
 }
 
+var forceDown bool
+
 func init() {
 	rootCmd.AddCommand(downCmd)
 
+	addWaitFlag(downCmd)
+	downCmd.Flags().BoolVar(&forceDown, "force", false, "Kill any hypervisor processes left behind for your VM, even without a pid file, and go ahead even when another blt command is changing your environment")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -41,3 +48,12 @@ func init() {
 	// is called directly, e.g.:
 	// downCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+func performDown() error {
+	// ephemeral environments do not outlive their VM
+	if environment().Ephemeral() {
+		return environment().Remove(context.Background())
+	}
+
+	return environment().Down(context.Background(), lit.DownOptions{Force: forceDown})
+}
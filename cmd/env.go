@@ -16,9 +16,7 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/aemengo/blt/path"
 	"github.com/spf13/cobra"
-	"os/exec"
 	"strings"
 )
 
@@ -46,13 +44,10 @@ func init() {
 }
 
 func fetchEnvironmentVariables() string {
-	output, _ := exec.Command("bash", "-c", fmt.Sprintf("bosh int %s --path /admin_password", path.BoshCredsPath(bltHomeDir))).Output()
-
-	return fmt.Sprintf(`export BOSH_ENVIRONMENT="10.0.0.4"
-export BOSH_CLIENT=admin
-export BOSH_CLIENT_SECRET="%s"
-export BOSH_CA_CERT=%s
-export BOSH_GW_HOST="10.0.0.4"
-export BOSH_GW_USER="jumpbox"
-export BOSH_GW_PRIVATE_KEY=%s`, strings.TrimSpace(string(output)), path.BoshCACertPath(bltHomeDir), path.BoshGWPrivateKeyPath(bltHomeDir))
+	var lines []string
+	for _, v := range environment().Env() {
+		lines = append(lines, fmt.Sprintf("export %s=%s", v.Key, shellQuote(v.Value)))
+	}
+
+	return strings.Join(lines, "\n")
 }
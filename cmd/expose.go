@@ -15,8 +15,11 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/aemengo/blt/vm"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/lit"
 	"github.com/ryanuber/columnize"
 	"github.com/spf13/cobra"
 	"strings"
@@ -36,6 +39,38 @@ For example:
 
 $ blt expose -L 10.0.0.5:80:10.0.0.5:80 -L 10.0.0.5:443:10.0.0.5:443
 
+The following shorthands and extensions are also understood:
+
+    -L 10.0.0.5:80                  same address and port on both ends
+    -L 25555                        a port of the BOSH director
+    -L 10.0.0.5:61000-61010         a range of ports
+    -L [fd00::5]:80:[fd00::5]:80    IPv6 addresses, in brackets
+    -L 10.0.0.5:514/udp             UDP instead of TCP
+
+Ports of a BOSH instance can be exposed without knowing its IP, which is
+resolved through the director on its own address:
+
+    -d <deployment> -i <group/index|group> -p <port>[:<hostport>]
+
+For example:
+
+$ blt expose -d cf -i router -p 443
+
+Ports of your machine can be made reachable from deployments as well, on
+an IP of the VM network that tunnels back to the host through the jumpbox
+of the director, for TCP only:
+
+    -R container_ip:port:host_address:port
+
+For example, to let jobs reach a Postgres running on your machine:
+
+$ blt expose --reverse -R 10.0.255.10:5432:127.0.0.1:5432
+
+Exposed ports are remembered and forwarded again by "blt up". Should an
+instance be recreated with a different IP, forward it again with:
+
+$ blt expose --refresh
+
 To list ports that are already exposed, simply invoke the command without
 any arguments:
 
@@ -50,7 +85,14 @@ exposed port.
 	},
 }
 
-var addresses []string
+var (
+	addresses        []string
+	reverseAddresses []string
+	reverseOnly      bool
+	instanceName     string
+	instancePorts    string
+	refreshForwards  bool
+)
 
 func init() {
 	rootCmd.AddCommand(exposeCmd)
@@ -66,35 +108,66 @@ func init() {
 	// exposeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	exposeCmd.Flags().StringSliceVarP(&addresses, "forward", "L", []string{}, "List of addresses to forward from VM to host")
+	exposeCmd.Flags().StringSliceVarP(&reverseAddresses, "remote", "R", []string{}, "List of addresses to forward from host to VM")
+	exposeCmd.Flags().BoolVar(&reverseOnly, "reverse", false, "Forward from host to VM, as implied by -R, or list only such forwards")
+	exposeCmd.Flags().StringVarP(&deploymentName, "deployment", "d", "", "Name of the deployment of the instance to expose")
+	exposeCmd.Flags().StringVarP(&instanceName, "instance", "i", "", "Instance to expose, as group/index, group/id or group for every instance")
+	exposeCmd.Flags().StringVarP(&instancePorts, "port", "p", "", "Port of the instance to expose, as <port>[:<hostport>] with an optional /udp suffix")
+	addWaitFlag(exposeCmd)
+	exposeCmd.Flags().BoolVar(&refreshForwards, "refresh", false, "Forward every remembered port again, resolving instance IPs anew")
 }
 
 func performExpose() error {
-	status := vm.GetStatus(bltHomeDir)
-	if status != vm.VMStatusRunning {
-		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
-	}
-
-	if len(addresses) == 0 {
-		addresses, err := vm.ListForwarded()
+	if len(addresses) == 0 && len(reverseAddresses) == 0 && deploymentName == "" && !refreshForwards {
+		forwards, err := environment().Forwards(context.Background())
 		if err != nil {
 			return err
 		}
 
-		presentAddresses(addresses)
+		var specs []forward.Spec
+		for _, s := range forwards {
+			if s.Reverse || !reverseOnly {
+				specs = append(specs, s)
+			}
+		}
+
+		presentAddresses(specs)
 		return nil
 	}
 
-	return vm.Forward(addresses)
+	opts := lit.ExposeOptions{Refresh: refreshForwards}
+
+	for _, address := range addresses {
+		opts.Rules = append(opts.Rules, forward.Rule{Declaration: address, Reverse: reverseOnly})
+	}
+
+	for _, address := range reverseAddresses {
+		opts.Rules = append(opts.Rules, forward.Rule{Declaration: address, Reverse: true})
+	}
+
+	if deploymentName != "" {
+		if instanceName == "" || instancePorts == "" {
+			return errors.New("exposing the ports of an instance requires all of -d, -i and -p")
+		}
+
+		opts.Rules = append(opts.Rules, forward.Rule{Deployment: deploymentName, Instance: instanceName, Ports: instancePorts})
+	}
+
+	return environment().Expose(context.Background(), opts)
 }
 
-func presentAddresses(addresses []string) {
-	fmtAddrs := append([]string{
-		"Host IP:Host Port:Container IP:Container Port",
-	}, addresses...)
+func presentAddresses(specs []forward.Spec) {
+	fmtAddrs := []string{"Direction|Protocol|Host IP|Host Port|Container IP|Container Port"}
+	for _, s := range specs {
+		direction := "VM -> host"
+		if s.Reverse {
+			direction = "host -> VM"
+		}
+
+		fmtAddrs = append(fmtAddrs, fmt.Sprintf("%s|%s|%s|%d|%s|%d", direction, s.Protocol, s.HostIP, s.HostPort, s.ContainerIP, s.ContainerPort))
+	}
 
-	config := columnize.DefaultConfig()
-	config.Delim = ":"
-	result := strings.Split(columnize.Format(fmtAddrs, config), "\n")
+	result := strings.Split(columnize.SimpleFormat(fmtAddrs), "\n")
 
 	boldWhite.Println(result[0])
 	fmt.Println(strings.Join(result[1:], "\n"))
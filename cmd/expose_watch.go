@@ -0,0 +1,266 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/aemengo/blt/director"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+var exposeWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Keep ports declared in deployment manifests exposed",
+	Long: fmt.Sprintf(`Keep ports declared in deployment manifests exposed.
+
+The director is polled for deployments, and the ports that an instance
+group declares under the blt.expose property are forwarded from each of
+its instances, as with "blt expose -p":
+
+instance_groups:
+- name: router
+  properties:
+    blt:
+      expose: ["80", "443", "8443:443", "514/udp"]
+
+Ports are forwarded as instances come and go or change IPs, and are no
+longer forwarded once their declaration, instance or deployment is gone.
+Every change is logged until the command is interrupted, upon which the
+ports that it forwarded are no longer forwarded.
+
+%s the blt.expose property is only read by blt, jobs ignore it.
+`, boldWhite.Sprint("Note:")),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performExposeWatch()
+		expectNoError(err)
+	},
+}
+
+var watchInterval time.Duration
+
+func init() {
+	exposeCmd.AddCommand(exposeWatchCmd)
+
+	exposeWatchCmd.Flags().DurationVar(&watchInterval, "interval", 10*time.Second, "How often to poll the director")
+	addWaitFlag(exposeWatchCmd)
+}
+
+func performExposeWatch() error {
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	client, err := environment().DirectorClient()
+	if err != nil {
+		return err
+	}
+
+	logChange(boldWhite.Sprint("*"), fmt.Sprintf("watching deployments of %s every %v", network.DirectorIP, watchInterval))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	// watched holds the specs forwarded by this command, so that
+	// forwards made by other means are never taken down
+	watched := map[string]string{}
+
+	for {
+		err := syncWatchedForwards(client, watched)
+		if err != nil {
+			logChange(boldRed.Sprint("!"), err.Error())
+		}
+
+		select {
+		case <-signals:
+			logChange(boldWhite.Sprint("*"), "no longer watching, taking down the forwards made")
+			return unforwardWatched(watched)
+		case <-ticker.C:
+		}
+	}
+}
+
+func syncWatchedForwards(client *director.Client, watched map[string]string) error {
+	desired, err := declaredForwards(client)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	listed, err := vm.ListForwarded(context.Background())
+	if err != nil {
+		return err
+	}
+
+	forwarded := forward.Strings(listed)
+
+	err = takeDownWatched(watched, desired)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range sortedKeys(desired) {
+		if contains(forwarded, spec) {
+			continue
+		}
+
+		err = vm.Forward(context.Background(), parsedSpec(spec))
+		if err != nil {
+			return err
+		}
+
+		logChange(boldGreen.Sprint("+"), fmt.Sprintf("%s (%s)", spec, desired[spec]))
+		watched[spec] = desired[spec]
+	}
+
+	return nil
+}
+
+// unforwardWatched takes down every watched forward
+func unforwardWatched(watched map[string]string) error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return takeDownWatched(watched, nil)
+}
+
+// takeDownWatched takes down the watched forwards that are not desired
+func takeDownWatched(watched map[string]string, desired map[string]string) error {
+	for _, spec := range sortedKeys(watched) {
+		if _, ok := desired[spec]; ok {
+			continue
+		}
+
+		err := vm.Unforward(context.Background(), bltHomeDir, parsedSpec(spec))
+		if err != nil {
+			return err
+		}
+
+		logChange(boldYellow.Sprint("-"), fmt.Sprintf("%s (%s)", spec, watched[spec]))
+		delete(watched, spec)
+	}
+
+	return nil
+}
+
+// declaredForwards returns the specs declared by the blt.expose property
+// of every deployment, mapped to the rule that declared them
+func declaredForwards(client *director.Client) (map[string]string, error) {
+	deployments, err := client.Deployments()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	for _, d := range deployments {
+		manifest, err := client.Manifest(d.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var m struct {
+			InstanceGroups []struct {
+				Name       string `yaml:"name"`
+				Properties struct {
+					BLT struct {
+						Expose []string `yaml:"expose"`
+					} `yaml:"blt"`
+				} `yaml:"properties"`
+			} `yaml:"instance_groups"`
+		}
+
+		err = yaml.Unmarshal([]byte(manifest), &m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest of deployment '%s': %s", d.Name, err)
+		}
+
+		var vms []director.VM
+		for _, group := range m.InstanceGroups {
+			if len(group.Properties.BLT.Expose) == 0 {
+				continue
+			}
+
+			if vms == nil {
+				vms, err = client.VMs(d.Name)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			var ips []string
+			for _, v := range vms {
+				if v.Matches(group.Name) {
+					ips = append(ips, v.IPs...)
+				}
+			}
+
+			for _, ports := range group.Properties.BLT.Expose {
+				rule := forward.Rule{Deployment: d.Name, Instance: group.Name, Ports: ports}
+
+				specs, err := rule.InstanceSpecs(ips)
+				if err != nil {
+					return nil, fmt.Errorf("deployment '%s' declares %s", d.Name, err)
+				}
+
+				for _, s := range forward.Strings(specs) {
+					result[s] = rule.String()
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// parsedSpec turns a formatted spec back into its parts
+func parsedSpec(spec string) []forward.Spec {
+	specs, _ := forward.Parse(spec, "")
+	return specs
+}
+
+func logChange(symbol string, message string) {
+	fmt.Printf("%s %s %s\n", time.Now().Format("15:04:05"), symbol, message)
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
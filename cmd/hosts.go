@@ -0,0 +1,255 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aemengo/blt/hosts"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostsCmd represents the hosts command
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Manage names of exposed instances in your hosts file",
+	Long: fmt.Sprintf(`Manage names of exposed instances in your hosts file.
+
+As an alternative to "blt dns", names of the director and of instances
+with exposed IPs can be kept in a block of the hosts file, delimited by
+BOSH Lit markers. Lines outside of that block are never touched.
+
+    director.blt.local
+    router.cf.blt.local
+    0.router.cf.blt.local
+
+Records of the dns section in $HOME/.blt/config.yml are included as well,
+except for wildcards. The hosts file defaults to /etc/hosts and can be
+changed with the hosts_file key of the same file.
+
+$ %s
+`, boldWhite.Sprint("blt hosts sync")),
+}
+
+var hostsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Write names of exposed instances to the hosts file",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performHostsSync()
+		expectNoError(err)
+	},
+}
+
+var hostsCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove everything blt added to the hosts file",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := updateHostsFile(nil)
+		expectNoError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hostsCmd)
+	hostsCmd.AddCommand(hostsSyncCmd)
+	hostsCmd.AddCommand(hostsCleanCmd)
+
+	addWaitFlag(hostsSyncCmd)
+	addWaitFlag(hostsCleanCmd)
+}
+
+func performHostsSync() error {
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	entries, err := hostEntries()
+	if err != nil {
+		return err
+	}
+
+	err = updateHostsFile(entries)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\n", boldWhite.Sprint(e.IP), strings.Join(e.Names, " "))
+	}
+
+	return nil
+}
+
+// hostEntries maps the names of the director, of exposed
+// instances and of dns records to the IPs they are reachable on
+func hostEntries() ([]hosts.Entry, error) {
+	var (
+		ips   []string
+		names = map[string][]string{}
+	)
+
+	add := func(ip string, name string) {
+		if _, ok := names[ip]; !ok {
+			ips = append(ips, ip)
+		}
+
+		if !contains(names[ip], name) {
+			names[ip] = append(names[ip], name)
+		}
+	}
+
+	add(network.DirectorIP, "director."+dnsConfig.Suffix)
+
+	// exposed maps container IPs to the host IPs they are reachable on
+	exposed := map[string]string{}
+	for _, s := range exposedSpecs() {
+		if ip := net.ParseIP(s.HostIP); ip != nil && !ip.IsUnspecified() {
+			exposed[s.ContainerIP] = s.HostIP
+		}
+	}
+
+	client, err := environment().DirectorClient()
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := client.Deployments()
+	if err != nil {
+		return nil, err
+	}
+
+	// instances maps deployment/group/id and deployment/group/index
+	// references to the host IP the instance is exposed on
+	instances := map[string]string{}
+
+	for _, d := range deployments {
+		vms, err := client.VMs(d.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range vms {
+			for _, ip := range v.IPs {
+				hostIP, ok := exposed[ip]
+				if !ok {
+					continue
+				}
+
+				group := fmt.Sprintf("%s.%s.%s", v.Job, d.Name, dnsConfig.Suffix)
+				add(hostIP, fmt.Sprintf("%s.%s", v.ID, group))
+				add(hostIP, fmt.Sprintf("%d.%s", v.Index, group))
+
+				if _, ok := instances[d.Name+"/"+v.Job]; !ok {
+					add(hostIP, group)
+					instances[d.Name+"/"+v.Job] = hostIP
+				}
+
+				instances[fmt.Sprintf("%s/%s/%s", d.Name, v.Job, v.ID)] = hostIP
+				instances[fmt.Sprintf("%s/%s/%d", d.Name, v.Job, v.Index)] = hostIP
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(dnsConfig.Records) {
+		value := dnsConfig.Records[name]
+		if strings.HasPrefix(name, "*.") {
+			continue
+		}
+
+		switch {
+		case exposed[value] != "":
+			add(exposed[value], name)
+		case net.ParseIP(value) != nil:
+			add(value, name)
+		case instances[value] != "":
+			add(instances[value], name)
+		}
+	}
+
+	var entries []hosts.Entry
+	for _, ip := range ips {
+		entries = append(entries, hosts.Entry{IP: ip, Names: names[ip]})
+	}
+
+	return entries, nil
+}
+
+// updateHostsFile replaces the block managed by blt in the hosts
+// file, with the help of sudo when the file belongs to root
+func updateHostsFile(entries []hosts.Entry) error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := ioutil.ReadFile(hostsFile)
+	if err != nil {
+		return err
+	}
+
+	contents, err := hosts.Render(data, entries)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %s", hostsFile, err)
+	}
+
+	if bytes.Equal(data, contents) {
+		return nil
+	}
+
+	err = hosts.Write(hostsFile, contents)
+	if !os.IsPermission(err) {
+		return err
+	}
+
+	// the file that a symlinked hosts file points to is replaced
+	target, err := filepath.EvalSymlinks(hostsFile)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile("", "blt-hosts-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	_, err = tmpFile.Write(contents)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+
+	// renaming within the same directory keeps the update atomic
+	staged := filepath.Join(filepath.Dir(target), ".blt-hosts")
+	return runAsRoot([]string{
+		fmt.Sprintf("cp %s %s", shellQuote(tmpFile.Name()), shellQuote(staged)),
+		fmt.Sprintf("chmod %o %s", info.Mode().Perm(), shellQuote(staged)),
+		fmt.Sprintf("mv %s %s", shellQuote(staged), shellQuote(target)),
+	})
+}
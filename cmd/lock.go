@@ -0,0 +1,27 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var waitForLock bool
+
+// addWaitFlag lets a command that locks the environment
+// wait for the lock rather than fail right away
+func addWaitFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&waitForLock, "wait", false, "Wait for other blt commands changing your environment to finish")
+}
@@ -0,0 +1,279 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/hostnet"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
+	"github.com/ryanuber/columnize"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// netCmd represents the net command
+var netCmd = &cobra.Command{
+	Use:   "net",
+	Short: "Manage loopback aliases for the director and exposed IPs",
+	Long: fmt.Sprintf(`Manage loopback aliases for the director and exposed IPs.
+
+For your machine to route traffic to the BOSH director and to exposed
+ports, their IPs must be assigned to the loopback interface. Aliases
+are lost on reboot, unless installed as a system service with:
+
+$ %s
+`, boldWhite.Sprint("blt net setup --persist")),
+}
+
+var netSetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Add loopback aliases for the director and exposed IPs",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performNetSetup()
+		expectNoError(err)
+	},
+}
+
+var netTeardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Remove loopback aliases for the director and exposed IPs",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performNetTeardown()
+		expectNoError(err)
+	},
+}
+
+var netStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which loopback aliases are in place",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performNetStatus()
+		expectNoError(err)
+	},
+}
+
+var persistAliases bool
+
+func init() {
+	rootCmd.AddCommand(netCmd)
+	netCmd.AddCommand(netSetupCmd)
+	netCmd.AddCommand(netTeardownCmd)
+	netCmd.AddCommand(netStatusCmd)
+
+	netSetupCmd.Flags().BoolVar(&persistAliases, "persist", false, "Install a system service that adds the aliases on every boot")
+	addWaitFlag(netSetupCmd)
+	addWaitFlag(netTeardownCmd)
+}
+
+func performNetSetup() error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ips := aliasedIPs()
+
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		return err
+	}
+
+	var commands []string
+	for _, ip := range ips {
+		if !assigned[ip] {
+			commands = append(commands, hostnet.AddAliasCommand(ip))
+		}
+	}
+
+	if persistAliases {
+		installer := hostnet.PersistentInstaller(ips)
+
+		tmpFile, err := ioutil.TempFile("", "blt-net-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpFile.Name())
+
+		_, err = tmpFile.WriteString(installer.Contents)
+		tmpFile.Close()
+		if err != nil {
+			return err
+		}
+
+		commands = append(commands,
+			fmt.Sprintf("cp %s %s", tmpFile.Name(), installer.Path),
+			fmt.Sprintf("chmod 0644 %s", installer.Path),
+			installer.Enable)
+	}
+
+	err = runAsRoot(commands)
+	if err != nil {
+		return err
+	}
+
+	return performNetStatus()
+}
+
+func performNetTeardown() error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		return err
+	}
+
+	var commands []string
+	for _, ip := range aliasedIPs() {
+		if assigned[ip] {
+			commands = append(commands, hostnet.RemoveAliasCommand(ip))
+		}
+	}
+
+	installer := hostnet.PersistentInstaller(nil)
+	if exists(installer.Path) {
+		commands = append(commands, installer.Disable, "rm -f "+installer.Path)
+	}
+
+	err = runAsRoot(commands)
+	if err != nil {
+		return err
+	}
+
+	return performNetStatus()
+}
+
+func performNetStatus() error {
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		return err
+	}
+
+	lines := []string{"IP|Purpose|Status"}
+	for i, ip := range aliasedIPs() {
+		purpose := "exposed"
+		if i == 0 {
+			purpose = "director"
+		}
+
+		status := "missing"
+		if assigned[ip] {
+			status = "assigned"
+		}
+
+		lines = append(lines, strings.Join([]string{ip, purpose, status}, "|"))
+	}
+
+	result := strings.Split(columnize.SimpleFormat(lines), "\n")
+	boldWhite.Println(result[0])
+	fmt.Println(strings.Join(result[1:], "\n"))
+
+	if exists(hostnet.PersistentInstaller(nil).Path) {
+		fmt.Printf("\nAliases are restored on boot by %s\n", boldWhite.Sprint(hostnet.PersistentInstaller(nil).Path))
+	}
+
+	return nil
+}
+
+// aliasedIPs returns the director IP, followed by the host
+// IPs of exposed ports that should be on the loopback interface
+func aliasedIPs() []string {
+	ips := []string{network.DirectorIP}
+
+	for _, s := range exposedSpecs() {
+		ip := net.ParseIP(s.HostIP)
+		if ip.To4() == nil || ip.IsLoopback() || ip.IsUnspecified() || contains(ips, s.HostIP) {
+			continue
+		}
+
+		ips = append(ips, s.HostIP)
+	}
+
+	return ips
+}
+
+// exposedSpecs returns the forwards of the current preset, those
+// remembered by "blt expose" and those in place on a running VM
+func exposedSpecs() []forward.Spec {
+	var forwards []string
+	if p, err := environment().CurrentPreset(); err == nil {
+		forwards = append(forwards, p.Expose...)
+	}
+
+	if rules, err := forward.LoadRules(path.ForwardsPath(bltHomeDir)); err == nil {
+		for _, r := range rules {
+			if !r.Reverse {
+				forwards = append(forwards, r.Applied...)
+			}
+		}
+	}
+
+	var specs []forward.Spec
+	for _, f := range forwards {
+		s, err := forward.Parse(f, network.DirectorIP)
+		if err != nil {
+			continue
+		}
+
+		specs = append(specs, s...)
+	}
+
+	if vm.GetStatus(context.Background(), bltHomeDir) == vm.VMStatusRunning {
+		if listed, err := vm.ListForwarded(context.Background()); err == nil {
+			specs = append(specs, listed...)
+		}
+	}
+
+	return specs
+}
+
+// runAsRoot runs the given shell commands at once,
+// so that sudo asks for a password at most one time
+func runAsRoot(commands []string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	script := "set -e; " + strings.Join(commands, "; ")
+
+	var command *exec.Cmd
+	if os.Geteuid() == 0 {
+		command = exec.Command("/bin/sh", "-c", script)
+	} else {
+		command = exec.Command("sudo", "/bin/sh", "-c", script)
+	}
+
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	err := command.Run()
+	if err != nil {
+		return fmt.Errorf("failed to execute '%s': %s", script, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/preset"
+	"github.com/ryanuber/columnize"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+// presetsCmd represents the presets command
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "List the presets available to \"blt up --preset\"",
+	Long: fmt.Sprintf(`List the presets available to "blt up --preset".
+
+A preset bundles the VM resources, cloud-config, runtime-configs, director
+ops files and ports to expose for a particular kind of deployment. Your own
+presets can be added to "$HOME/.blt/presets/<name>.yml", for example:
+
+    extends: cf
+    memory: 12288
+    ops_files:
+    - my-director-ops.yml
+
+Relative paths are resolved against the presets directory. The preset chosen
+with "blt up" is remembered until %s.
+`, boldWhite.Sprint("blt destroy")),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performListPresets()
+		expectNoError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(presetsCmd)
+}
+
+func performListPresets() error {
+	presets, err := preset.List(path.PresetsDir(bltHomeDir), path.AssetDir(bltHomeDir))
+	if err != nil {
+		return err
+	}
+
+	current, _ := environment().CurrentPresetName()
+
+	lines := []string{"Name|CPU|Memory|Disk|Description"}
+	for _, p := range presets {
+		name := p.Name
+		if name == current {
+			name = name + "*"
+		}
+
+		lines = append(lines, strings.Join([]string{name, p.CPU, p.Memory + "MB", p.Disk + "GB", p.Description}, "|"))
+	}
+
+	result := strings.Split(columnize.SimpleFormat(lines), "\n")
+	boldWhite.Println(result[0])
+	fmt.Println(strings.Join(result[1:], "\n"))
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/proxy"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+	"net"
+	"os/exec"
+	"time"
+)
+
+// proxyCmd represents the proxy command
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Reach any IP of the BOSH network through a local proxy",
+	Long: fmt.Sprintf(`Reach any IP of the BOSH network through a local proxy.
+
+Rather than exposing ports one at a time, applications that support a
+SOCKS5 or HTTP proxy can reach every instance through the director's
+jumpbox. Connections to any other address are made directly, unless it
+is within a network given with --cidr, like the one of a cloud-config.
+
+$ blt proxy --socks 127.0.0.1:1080 --http 127.0.0.1:8080
+
+For example:
+
+$ curl --proxy socks5h://127.0.0.1:1080 http://10.0.0.5
+$ export HTTPS_PROXY=http://127.0.0.1:8080
+
+%s loopback aliases and exposed ports are not needed for proxied connections.
+`, boldWhite.Sprint("Note:")),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performProxy()
+		expectNoError(err)
+	},
+}
+
+var (
+	socksAddr  string
+	httpAddr   string
+	proxyCIDRs []string
+)
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+
+	proxyCmd.Flags().StringVar(&socksAddr, "socks", "127.0.0.1:1080", "Address to serve a SOCKS5 proxy on, or empty for none")
+	proxyCmd.Flags().StringVar(&httpAddr, "http", "", "Address to serve an HTTP proxy on, or empty for none")
+	proxyCmd.Flags().StringSliceVar(&proxyCIDRs, "cidr", []string{}, "Additional networks to reach through the jumpbox")
+}
+
+func performProxy() error {
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	if socksAddr == "" && httpAddr == "" {
+		return errors.New("at least one of --socks or --http must be given")
+	}
+
+	proxySubnets = []*net.IPNet{network.Subnet()}
+	for _, c := range proxyCIDRs {
+		_, subnet, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("cidr '%s' is not valid", c)
+		}
+
+		proxySubnets = append(proxySubnets, subnet)
+	}
+
+	errChan := make(chan error, 2)
+
+	if socksAddr != "" {
+		l, err := net.Listen("tcp", socksAddr)
+		if err != nil {
+			return err
+		}
+
+		logChange(boldWhite.Sprint("*"), fmt.Sprintf("serving SOCKS5 proxy on %s", socksAddr))
+		go func() { errChan <- proxy.ServeSOCKS(l, proxyDial) }()
+	}
+
+	if httpAddr != "" {
+		l, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			return err
+		}
+
+		logChange(boldWhite.Sprint("*"), fmt.Sprintf("serving HTTP proxy on %s", httpAddr))
+		go func() { errChan <- proxy.ServeHTTP(l, proxyDial) }()
+	}
+
+	return <-errChan
+}
+
+// proxyDial connects to addresses within the BOSH network, and names
+// that do not resolve from the host, through the jumpbox of the director
+func proxyDial(addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !withinNetwork(host) {
+		return net.DialTimeout("tcp", addr, 30*time.Second)
+	}
+
+	// a master connection is shared by every
+	// proxied connection and outlives them briefly
+	args := append(environment().JumpboxOptions(),
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath="+path.JumpboxControlPath(bltHomeDir),
+		"-o", "ControlPersist=60",
+		"-W", addr,
+		"jumpbox@"+network.DirectorIP)
+
+	return proxy.DialCommand(exec.Command("ssh", args...), addr)
+}
+
+var proxySubnets []*net.IPNet
+
+func withinNetwork(host string) bool {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		ips, err = net.LookupIP(host)
+		if err != nil {
+			return true
+		}
+	}
+
+	for _, ip := range ips {
+		for _, subnet := range proxySubnets {
+			if subnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -15,8 +15,7 @@
 package cmd
 
 import (
-	"fmt"
-	"github.com/aemengo/blt/vm"
+	"context"
 	"github.com/spf13/cobra"
 )
 
@@ -35,6 +34,7 @@ Typically useful for reclaiming disk space after deleting multiple BOSH deployme
 
 func init() {
 	rootCmd.AddCommand(pruneCmd)
+	addWaitFlag(pruneCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -48,10 +48,5 @@ func init() {
 }
 
 func performPrune() error {
-	status := vm.GetStatus(bltHomeDir)
-	if status != vm.VMStatusRunning {
-		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
-	}
-
-	return vm.Prune()
+	return environment().Prune(context.Background())
 }
\ No newline at end of file
@@ -0,0 +1,384 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/release"
+	"github.com/aemengo/blt/vm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// releasesCmd represents the releases command
+var releasesCmd = &cobra.Command{
+	Use:   "releases",
+	Short: "Share compiled releases between environments",
+	Long: `Compiled releases are kept in "$HOME/.blt/cache/releases", and
+therefore survive "blt destroy". Export them from a deployment once:
+
+$ blt releases export -d cf
+
+and upload them to any fresh director before deploying:
+
+$ blt releases import
+`,
+}
+
+var releasesExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the compiled releases of a deployment into the cache",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performReleasesExport()
+		expectNoError(err)
+	},
+}
+
+var releasesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Upload cached compiled releases that the director is missing",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performReleasesImport()
+		expectNoError(err)
+	},
+}
+
+var deploymentName string
+
+func init() {
+	rootCmd.AddCommand(releasesCmd)
+	releasesCmd.AddCommand(releasesExportCmd)
+	releasesCmd.AddCommand(releasesImportCmd)
+
+	releasesExportCmd.Flags().StringVarP(&deploymentName, "deployment", "d", "", "Name of the deployment to export releases from")
+	addWaitFlag(releasesImportCmd)
+}
+
+func performReleasesExport() error {
+	if deploymentName == "" {
+		return errors.New("a deployment must be specified with --deployment")
+	}
+
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	releases, err := deploymentReleases(deploymentName)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range releases {
+		boldWhite.Printf("Exporting %s...  ", r)
+
+		if release.Has(path.ReleaseCacheDir(bltHomeDir), r) {
+			boldGreen.Println("Cached")
+			continue
+		}
+
+		err = exportRelease(deploymentName, r)
+		if err != nil {
+			boldRed.Println("Failed")
+			return err
+		}
+
+		boldGreen.Println("Success")
+	}
+
+	return nil
+}
+
+func performReleasesImport() error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	status := vm.GetStatus(context.Background(), bltHomeDir)
+	if status != vm.VMStatusRunning {
+		return fmt.Errorf("your VM must be running before you can perform this action, it is currently: %s", boldWhite.Sprint(status))
+	}
+
+	releases, err := release.List(path.ReleaseCacheDir(bltHomeDir))
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := directorReleases()
+	if err != nil {
+		return err
+	}
+
+	stemcells, err := environment().DirectorStemcells()
+	if err != nil {
+		return err
+	}
+
+	compiled := map[string]map[string]bool{}
+	for _, r := range releases {
+		boldWhite.Printf("Importing %s...  ", r)
+
+		nameVersion := r.Name + "/" + r.Version
+		if uploaded[nameVersion] {
+			if _, ok := compiled[nameVersion]; !ok {
+				compiled[nameVersion], err = compiledStemcells(nameVersion)
+				if err != nil {
+					boldRed.Println("Failed")
+					return err
+				}
+			}
+
+			if compiled[nameVersion][r.OS+"/"+r.StemcellVersion] {
+				boldGreen.Println("Present")
+				continue
+			}
+		}
+
+		if !stemcells[r.OS+"/"+r.StemcellVersion] {
+			boldYellow.Println("Skipped, stemcell not uploaded")
+			continue
+		}
+
+		output, err := environment().BoshCommand("-n", "upload-release", r.Path).CombinedOutput()
+		if err != nil {
+			boldRed.Println("Failed")
+			return fmt.Errorf("failed to upload release %s: %s: %s", r, err, output)
+		}
+
+		boldGreen.Println("Success")
+	}
+
+	return nil
+}
+
+// deploymentReleases returns every release and stemcell pair that the
+// given deployment is compiled against, which is the stemcell of every
+// instance group that a job of the release is placed on
+func deploymentReleases(name string) ([]release.Compiled, error) {
+	rows, err := environment().BoshTableRows("deployments")
+	if err != nil {
+		return nil, err
+	}
+
+	var deployment map[string]string
+	for _, row := range rows {
+		if row["name"] == name {
+			deployment = row
+		}
+	}
+
+	if deployment == nil {
+		return nil, fmt.Errorf("deployment '%s' does not exist", name)
+	}
+
+	rows, err = environment().BoshTableRows("stemcells")
+	if err != nil {
+		return nil, err
+	}
+
+	// deployments reference stemcells by name,
+	// while exports require the operating system
+	operatingSystems := map[string]string{}
+	for _, row := range rows {
+		operatingSystems[row["name"]+"/"+strings.TrimSuffix(row["version"], "*")] = row["os"]
+	}
+
+	// the stemcells in use, which manifests may only
+	// reference as "latest", keyed by name and os
+	deployed := map[string]string{}
+	for _, s := range strings.Fields(deployment["stemcell_s"]) {
+		operatingSystem, ok := operatingSystems[s]
+		if !ok {
+			return nil, fmt.Errorf("stemcell '%s' of deployment '%s' is not uploaded", s, name)
+		}
+
+		deployed[strings.Split(s, "/")[0]] = operatingSystem + "/" + strings.Split(s, "/")[1]
+		deployed[operatingSystem] = operatingSystem + "/" + strings.Split(s, "/")[1]
+	}
+
+	// the same goes for releases
+	versions := map[string]string{}
+	for _, r := range strings.Fields(deployment["release_s"]) {
+		versions[strings.Split(r, "/")[0]] = strings.Split(r, "/")[1]
+	}
+
+	client, err := environment().DirectorClient()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := client.Manifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var m deploymentManifest
+	err = yaml.Unmarshal([]byte(manifest), &m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest of deployment '%s': %s", name, err)
+	}
+
+	aliases := map[string]string{}
+	for _, s := range m.Stemcells {
+		stemcell, ok := deployed[s.OS]
+		if !ok {
+			stemcell, ok = deployed[s.Name]
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("stemcell '%s' of deployment '%s' is not in use", s.Alias, name)
+		}
+
+		aliases[s.Alias] = stemcell
+	}
+
+	var (
+		releases []release.Compiled
+		seen     = map[string]bool{}
+	)
+
+	add := func(releaseName string, stemcell string) {
+		version, ok := versions[releaseName]
+		if !ok || stemcell == "" || seen[releaseName+" "+stemcell] {
+			return
+		}
+
+		seen[releaseName+" "+stemcell] = true
+		releases = append(releases, release.Compiled{
+			Name:            releaseName,
+			Version:         version,
+			OS:              strings.Split(stemcell, "/")[0],
+			StemcellVersion: strings.Split(stemcell, "/")[1],
+		})
+	}
+
+	for _, group := range m.InstanceGroups {
+		for _, job := range group.Jobs {
+			add(job.Release, aliases[group.Stemcell])
+		}
+
+		// addons are placed on every instance group
+		for _, addon := range m.Addons {
+			for _, job := range addon.Jobs {
+				add(job.Release, aliases[group.Stemcell])
+			}
+		}
+	}
+
+	return releases, nil
+}
+
+func directorReleases() (map[string]bool, error) {
+	rows, err := environment().BoshTableRows("releases")
+	if err != nil {
+		return nil, err
+	}
+
+	releases := map[string]bool{}
+	for _, row := range rows {
+		// versions currently in use are marked with an asterisk
+		releases[row["name"]+"/"+strings.TrimSuffix(row["version"], "*")] = true
+	}
+
+	return releases, nil
+}
+
+// compiledStemcells returns the stemcells, as os/version, that the
+// packages of the release on the director are compiled against
+func compiledStemcells(nameVersion string) (map[string]bool, error) {
+	tables, err := environment().BoshTables("inspect-release", nameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	stemcells := map[string]bool{}
+	for _, rows := range tables {
+		for _, row := range rows {
+			// packages that are not compiled are listed as "(source)"
+			if strings.Contains(row["compiled_for"], "/") {
+				stemcells[row["compiled_for"]] = true
+			}
+		}
+	}
+
+	return stemcells, nil
+}
+
+// deploymentManifest is what deploymentReleases
+// reads of the manifest of a deployment
+type deploymentManifest struct {
+	Stemcells []struct {
+		Alias string `yaml:"alias"`
+		OS    string `yaml:"os"`
+		Name  string `yaml:"name"`
+	} `yaml:"stemcells"`
+
+	InstanceGroups []struct {
+		Stemcell string        `yaml:"stemcell"`
+		Jobs     []manifestJob `yaml:"jobs"`
+	} `yaml:"instance_groups"`
+
+	Addons []struct {
+		Jobs []manifestJob `yaml:"jobs"`
+	} `yaml:"addons"`
+}
+
+type manifestJob struct {
+	Release string `yaml:"release"`
+}
+
+func exportRelease(deployment string, r release.Compiled) error {
+	err := os.MkdirAll(path.ReleaseCacheDir(bltHomeDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// exported within the cache directory
+	// so that it can be moved into place
+	tmpDir, err := ioutil.TempDir(path.ReleaseCacheDir(bltHomeDir), ".export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	output, err := environment().BoshCommand("-d", deployment, "export-release",
+		r.Name+"/"+r.Version,
+		r.OS+"/"+r.StemcellVersion,
+		"--dir", tmpDir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to export release %s: %s: %s", r, err, output)
+	}
+
+	files, err := filepath.Glob(filepath.Join(tmpDir, "*.tgz"))
+	if err != nil {
+		return err
+	}
+
+	if len(files) != 1 {
+		return fmt.Errorf("failed to export release %s: expected a single tarball in %s", r, tmpDir)
+	}
+
+	_, err = release.Add(path.ReleaseCacheDir(bltHomeDir), files[0], r)
+	return err
+}
@@ -17,6 +17,10 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"github.com/aemengo/blt/config"
+	"github.com/aemengo/blt/lit"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
 	"github.com/fatih/color"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -27,6 +31,10 @@ import (
 
 var (
 	bltHomeDir string
+	network    config.Network
+	dnsConfig  config.DNS
+	hostsFile  string
+	vmRuntime  string
 	boldWhite  = color.New(color.FgWhite, color.Bold)
 	boldGreen  = color.New(color.FgGreen, color.Bold)
 	boldYellow = color.New(color.FgYellow, color.Bold)
@@ -37,42 +45,61 @@ var (
 var rootCmd = &cobra.Command{
 	Use:   "blt",
 	Short: "CLI for managing BOSH Lit VMs",
-	Long: fmt.Sprintf(`
-blt (short for BOSH Lit) is a CLI for managing a BOSH Lit VM.
-This tool provides an easy way to get up and running with a local, low-footprint
-BOSH environment that supports deployments.
-
-%s
-
-Website: https://github.com/aemengo/blt`, gettingStartedInstructions()),
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+
+	// help and version must work even with a broken config.yml
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if cmd.Name() == "help" || cmd == versionCmd {
+			return
+		}
+
+		err := initConfig()
+		expectNoError(err)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// the help text shows the configured network, falling back on the
+	// default one when the configuration is broken, which is reported
+	// by the commands that depend on it
+	if initConfig() != nil {
+		network = config.DefaultNetwork
+	}
+
+	rootCmd.Long = fmt.Sprintf(`
+blt (short for BOSH Lit) is a CLI for managing a BOSH Lit VM.
+This tool provides an easy way to get up and running with a local, low-footprint
+BOSH environment that supports deployments.
+
+%s
+
+Website: https://github.com/aemengo/blt`, gettingStartedInstructions())
+
 	err := rootCmd.Execute()
 	expectNoError(err)
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.blt.yaml)")
+	rootCmd.PersistentFlags().DurationVar(&vm.Timeout, "timeout", vm.Timeout, "How long to wait on each call to the VM before giving up")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	//rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func initConfig() {
+func initConfig() error {
 	home, err := homedir.Dir()
-	expectNoError(err)
+	if err != nil {
+		return err
+	}
 
 	if envHome := os.Getenv("BLT_HOME"); envHome != "" {
 		home = envHome
@@ -80,7 +107,44 @@ func initConfig() {
 
 	bltHomeDir = filepath.Join(home, ".blt")
 	err = os.MkdirAll(bltHomeDir, os.ModePerm)
-	expectNoError(err)
+	if err != nil {
+		return err
+	}
+
+	c, err := config.Load(path.ConfigPath(bltHomeDir))
+	if err != nil {
+		return err
+	}
+
+	network = c.Network
+	dnsConfig = c.DNS
+	hostsFile = c.HostsFile
+	vmRuntime = c.Runtime
+	return nil
+}
+
+var currentEnvironment *lit.Environment
+
+// environment returns the BOSH Lit environment that commands act
+// upon, set up on first use so that the flags are parsed by then
+func environment() *lit.Environment {
+	if currentEnvironment == nil {
+		currentEnvironment = lit.New(environmentOptions())
+	}
+
+	return currentEnvironment
+}
+
+func environmentOptions() lit.Options {
+	return lit.Options{
+		HomeDir:  bltHomeDir,
+		Version:  version,
+		Network:  network,
+		Runtime:  vmRuntime,
+		Wait:     waitForLock,
+		Output:   os.Stdout,
+		Progress: presentProgress,
+	}
 }
 
 func expectNoError(err error) {
@@ -114,11 +178,26 @@ func askForConfirmation(s string, attempts int) bool {
 	return false
 }
 
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
+// shellQuote quotes the word for use in a shell command
+func shellQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
 func gettingStartedInstructions() string {
 	return fmt.Sprintf(`Getting Started
 ===============
@@ -137,10 +216,18 @@ Networking
 ==========
 
 BOSH Lit is provisioned with the network of %s. It also has a minimal cloud-config
-pre-configured with the appropriate attributes. Should you wish to deploy Cloud Foundry
-on your local instance, you can use this cloud-config here:
+pre-configured with the appropriate attributes. The network can be changed before
+your first "blt up" in "$HOME/.blt/config.yml", for example:
+
+network:
+  director_ip: 172.31.0.4
+  cidr: 172.31.0.0/16
+  gateway: 172.31.0.1
 
-https://github.com/aemengo/bosh-runc-cpi-release/blob/master/operations/cf/cloud-config.yml
+Should you wish to deploy Cloud Foundry on your local instance, you can bring your VM
+up with the "cf" preset instead:
+
+$ %s
 
 In order to access ports for new deployments from the host, you must use the "blt expose" command.
 Port forwarding is done à la ssh. For more information, you can invoke the following:
@@ -160,10 +247,11 @@ $ %s
 To see the message again, you can always run the blt CLI tool with no arguments:
 
 $ %s`,
-		boldWhite.Sprint("10.0.0.4"),
-		boldWhite.Sprint("sudo ifconfig lo0 alias 10.0.0.4"),
+		boldWhite.Sprint(network.DirectorIP),
+		boldWhite.Sprint("blt net setup"),
 		boldWhite.Sprintf(`eval "$(blt env)"`),
-		boldWhite.Sprintf("10.0.0.0/16"),
+		boldWhite.Sprint(network.CIDR),
+		boldWhite.Sprintf("blt up --preset cf"),
 		boldWhite.Sprintf("blt expose -h"),
 		boldWhite.Sprintf("export BLT_HOME=/path/to/dir"),
 		boldWhite.Sprintf("blt"),
@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"github.com/aemengo/blt/vm"
 	"github.com/spf13/cobra"
 )
@@ -24,7 +26,7 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the status of your local BOSH Lit VM",
 	Run: func(cmd *cobra.Command, args []string) {
-		status := vm.GetStatus(bltHomeDir)
+		status, err := environment().Status(context.Background())
 		switch status {
 		case vm.VMStatusRunning:
 			boldGreen.Println(status)
@@ -32,6 +34,7 @@ var statusCmd = &cobra.Command{
 			boldWhite.Println(status)
 		default:
 			boldRed.Println(status)
+			fmt.Println(err)
 		}
 	},
 }
@@ -0,0 +1,143 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/stemcell"
+	"github.com/aemengo/blt/web"
+	"github.com/dustin/go-humanize"
+	"github.com/ryanuber/columnize"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// stemcellCmd represents the stemcell command
+var stemcellCmd = &cobra.Command{
+	Use:   "stemcell",
+	Short: "Manage stemcells cached on the host",
+	Long: fmt.Sprintf(`Stemcells added here are kept in "$HOME/.blt/cache/stemcells", and
+therefore survive "blt destroy". They can be uploaded to a fresh
+director without downloading them again:
+
+$ blt stemcell add https://bosh.io/d/stemcells/bosh-warden-boshlite-ubuntu-xenial-go_agent --sha1 <sha1>
+$ blt up %s
+`, boldWhite.Sprint("--upload-stemcells")),
+}
+
+var stemcellAddCmd = &cobra.Command{
+	Use:   "add <url|file>",
+	Short: "Add a stemcell to the cache",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performStemcellAdd(args[0])
+		expectNoError(err)
+	},
+}
+
+var stemcellListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached stemcells",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performStemcellList()
+		expectNoError(err)
+	},
+}
+
+var stemcellRmCmd = &cobra.Command{
+	Use:   "rm <name/version>",
+	Short: "Remove a stemcell from the cache",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performStemcellRm(args[0])
+		expectNoError(err)
+	},
+}
+
+var stemcellSHA string
+
+func init() {
+	rootCmd.AddCommand(stemcellCmd)
+	stemcellCmd.AddCommand(stemcellAddCmd)
+	stemcellCmd.AddCommand(stemcellListCmd)
+	stemcellCmd.AddCommand(stemcellRmCmd)
+
+	stemcellAddCmd.Flags().StringVar(&stemcellSHA, "sha1", "", "SHA1 checksum the stemcell must match")
+	addWaitFlag(stemcellAddCmd)
+	addWaitFlag(stemcellRmCmd)
+}
+
+func performStemcellAdd(src string) error {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		messageChan := make(chan string, 10)
+		go printMessages(messageChan)
+		file, err := web.Download(src, stemcellSHA, messageChan)
+		stopIndeterminateProgressAnimation()
+		defer os.RemoveAll(file)
+		if err != nil {
+			return err
+		}
+
+		src, stemcellSHA = file, ""
+	}
+
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := stemcell.Add(path.StemcellCacheDir(bltHomeDir), src, stemcellSHA)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %s\n", boldWhite.Sprint(s))
+	return nil
+}
+
+func performStemcellRm(ref string) error {
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return stemcell.Remove(path.StemcellCacheDir(bltHomeDir), ref)
+}
+
+func performStemcellList() error {
+	stemcells, err := stemcell.List(path.StemcellCacheDir(bltHomeDir))
+	if err != nil {
+		return err
+	}
+
+	lines := []string{"Name|Version|Size|SHA1"}
+	for _, s := range stemcells {
+		var size string
+		if fi, err := os.Stat(s.Path); err == nil {
+			size = humanize.Bytes(uint64(fi.Size()))
+		}
+
+		lines = append(lines, strings.Join([]string{s.Name, s.Version, size, s.SHA1}, "|"))
+	}
+
+	result := strings.Split(columnize.SimpleFormat(lines), "\n")
+	boldWhite.Println(result[0])
+	fmt.Println(strings.Join(result[1:], "\n"))
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/lit"
+	"github.com/ryanuber/columnize"
+	"github.com/spf13/cobra"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// toolsCmd represents the tools command
+var toolsCmd = &cobra.Command{
+	Use:   "tools",
+	Short: "Manage the bosh and linuxkit binaries that blt runs",
+	Long: fmt.Sprintf(`Manage the bosh and linuxkit binaries that blt runs.
+
+Rather than whatever is first on your PATH, blt runs binaries pinned under
+$HOME/.blt/tools/<version>, which come with the assets or are installed
+by hand. The highest pinned version that the assets support is used, as
+long as it still matches its checksum.
+
+$ %s
+`, boldWhite.Sprint("blt tools install ~/Downloads/bosh-cli-6.4.1-darwin-amd64")),
+}
+
+var toolsInstallCmd = &cobra.Command{
+	Use:   "install <file>",
+	Short: "Pin a bosh or linuxkit binary",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performToolsInstall(args[0])
+		expectNoError(err)
+	},
+}
+
+var toolsWhichCmd = &cobra.Command{
+	Use:   "which",
+	Short: "Show which binaries blt will run",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := performToolsWhich()
+		expectNoError(err)
+	},
+}
+
+var (
+	toolName   string
+	toolSHA256 string
+)
+
+func init() {
+	rootCmd.AddCommand(toolsCmd)
+	toolsCmd.AddCommand(toolsInstallCmd)
+	toolsCmd.AddCommand(toolsWhichCmd)
+
+	toolsInstallCmd.Flags().StringVar(&toolName, "name", "", "Name of the tool, bosh or linuxkit (default is guessed from the file name)")
+	toolsInstallCmd.Flags().StringVar(&toolSHA256, "sha256", "", "Expected sha256 checksum of the file")
+	addWaitFlag(toolsInstallCmd)
+}
+
+func performToolsInstall(file string) error {
+	name := toolName
+	if name == "" {
+		for _, t := range lit.PinnableTools {
+			if strings.HasPrefix(filepath.Base(file), t) {
+				name = t
+			}
+		}
+	}
+
+	if name == "" {
+		return fmt.Errorf("could not tell which tool %s is, pass one of %s with --name", file, strings.Join(lit.PinnableTools, ", "))
+	}
+
+	unlock, err := environment().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	t, err := environment().InstallTool(name, file, toolSHA256)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pinned %s %s at %s\n", boldWhite.Sprint(t.Name), t.Version, t.Path)
+	return nil
+}
+
+func performToolsWhich() error {
+	lines := []string{"Name|Version|Source|Path"}
+	for _, name := range lit.PinnableTools {
+		t, ok := environment().PinnedTool(name)
+		if ok {
+			lines = append(lines, strings.Join([]string{name, t.Version, "pinned", t.Path}, "|"))
+			continue
+		}
+
+		p, err := exec.LookPath(name)
+		if err != nil {
+			lines = append(lines, strings.Join([]string{name, "-", "missing", "-"}, "|"))
+			continue
+		}
+
+		v := "unknown"
+		d, _ := lit.DependencyNamed(name)
+		if found, err := environment().Inspect(d); err == nil && found != nil {
+			v = found.String()
+		}
+
+		lines = append(lines, strings.Join([]string{name, v, "PATH", p}, "|"))
+	}
+
+	result := strings.Split(columnize.SimpleFormat(lines), "\n")
+	boldWhite.Println(result[0])
+	fmt.Println(strings.Join(result[1:], "\n"))
+	return nil
+}
@@ -15,21 +15,18 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/lit"
 	"github.com/aemengo/blt/vm"
-	"github.com/aemengo/blt/web"
-	"io/ioutil"
-	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // upCmd represents the up command
@@ -37,17 +34,22 @@ var upCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Spin up a local BOSH Lit VM with accessible BOSH director",
 	Run: func(cmd *cobra.Command, args []string) {
-		err := performUp()
+		err := performUp(cmd.Flags())
 		stopIndeterminateProgressAnimation()
 		expectNoError(err)
 	},
 }
 
 var (
-	cpu      string
-	memory   string
-	disk     string
-	doneChan = make(chan bool, 1)
+	cpu             string
+	memory          string
+	disk            string
+	presetName      string
+	uploadStemcells bool
+	dryRun          bool
+	fromPhase       string
+	ephemeral       bool
+	doneChan        = make(chan bool, 1)
 )
 
 func init() {
@@ -63,144 +65,184 @@ func init() {
 	// is called directly, e.g.:
 	// upCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
-	upCmd.Flags().StringVarP(&cpu, "cpu", "c", "4", "Number of cores to allocate to VM")
-	upCmd.Flags().StringVarP(&memory, "memory", "m", "4096", "Amount of memory to allocate to VM in megabytes")
-	upCmd.Flags().StringVarP(&disk, "disk", "d", "40", "Amount of disk space to allocate to VM in gigabytes")
+	upCmd.Flags().StringVarP(&cpu, "cpu", "c", lit.DefaultCPU, "Number of cores to allocate to VM")
+	upCmd.Flags().StringVarP(&memory, "memory", "m", lit.DefaultMemory, "Amount of memory to allocate to VM in megabytes")
+	upCmd.Flags().StringVarP(&disk, "disk", "d", lit.DefaultDisk, "Amount of disk space to allocate to VM in gigabytes")
+	upCmd.Flags().StringVarP(&presetName, "preset", "p", "", `Preset to bring the VM up with, see "blt presets" (default is the last one used)`)
+	addWaitFlag(upCmd)
+	upCmd.Flags().BoolVar(&uploadStemcells, "upload-stemcells", false, `Upload stemcells cached with "blt stemcell add" that the director is missing`)
+	upCmd.Flags().StringVar(&fromPhase, "from", "", "Phase to start at, one of: "+strings.Join(lit.Phases, ", ")+" (default is the one the last failed 'blt up' stopped at)")
+	upCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the commands and changes of every step without carrying them out")
+	upCmd.Flags().BoolVar(&ephemeral, "ephemeral", false, `Bring up a throwaway environment in a temporary directory in place of yours, which "blt down" deletes`)
 }
 
-func performUp() error {
-	status := vm.GetStatus(bltHomeDir)
-	if status != vm.VMStatusStopped {
-		fmt.Println("BOSH Lit is already running...")
-		return nil
+func performUp(flags *pflag.FlagSet) error {
+	opts := lit.UpOptions{
+		Preset:          presetName,
+		UploadStemcells: uploadStemcells,
+		From:            fromPhase,
 	}
 
-	boldWhite.Print("Validating Prerequisites...   ")
-	err := checkForDependencies()
-	if err != nil {
-		return err
+	// the resources of the preset apply unless overridden by flags
+	if flags.Changed("cpu") {
+		opts.CPU = cpu
 	}
 
-	err = checkNetworkAddrs()
-	if err != nil {
-		return err
+	if flags.Changed("memory") {
+		opts.Memory = memory
 	}
-	boldGreen.Println("Success")
 
-	startTime := time.Now()
-	boldWhite.Print("Checking Assets...   ")
+	if flags.Changed("disk") {
+		opts.Disk = disk
+	}
 
-	ok := checkNeedsUpdates()
-	if !ok {
-		boldGreen.Println("Success")
-	} else {
-		boldYellow.Println("Needs Updates")
+	if ephemeral {
+		return performEphemeralUp(opts)
+	}
 
-		messageChan := make(chan string, 10)
-		go printMessages(messageChan)
-		err = web.DownloadAssets(version, bltHomeDir, messageChan)
-		if err != nil {
-			return err
-		}
+	env := environment()
+	if dryRun {
+		envOpts := environmentOptions()
+		envOpts.Runner = lit.DryRunner{Output: os.Stdout}
+		env = lit.New(envOpts)
+	}
 
-		stopIndeterminateProgressAnimation()
+	startTime := time.Now()
+
+	err := env.Up(context.Background(), opts)
+	if err == lit.ErrRunning {
+		fmt.Println("BOSH Lit is already running...")
+		return nil
 	}
 
-	err = os.RemoveAll(path.Pidpath(bltHomeDir))
 	if err != nil {
 		return err
 	}
 
-	boldWhite.Print("Starting VM")
-	go showIndeterminateProgressAnimation()
-	command := exec.Command(
-		"linuxkit", "run", "hyperkit",
-		"-console-file",
-		"-iso", "-uefi",
-		"-cpus="+cpu, "-mem="+memory,
-		"-disk", "size="+disk+"G",
-		"-networking", "vpnkit",
-		"-vpnkit", filepath.Join(path.AssetDir(bltHomeDir), "vpnkit"),
-		"-publish", "9999:9999/tcp",
-		"-publish", "9998:9998/tcp",
-		"-state", path.LinuxkitStatePath(bltHomeDir),
-		path.EFIisoPath(bltHomeDir))
-
-	logFile, err := os.Create(filepath.Join(bltHomeDir, "linuxkit.log"))
-	if err != nil {
-		return err
+	if dryRun {
+		boldGreen.Println("\nNothing was changed, as this was a dry run")
+		return nil
 	}
-	defer logFile.Close()
 
-	command.Stdout = logFile
-	command.Stderr = logFile
+	boldGreen.Printf("\nCompleted in %v\n\n", time.Since(startTime))
+	return nil
+}
 
-	err = command.Start()
-	if err != nil {
-		return err
+// performEphemeralUp brings up an ephemeral environment, which is
+// left in place when it fails so that its logs can be looked into
+func performEphemeralUp(opts lit.UpOptions) error {
+	if dryRun || opts.From != "" {
+		return errors.New("--ephemeral cannot be combined with --dry-run or --from")
 	}
 
-	err = vm.WaitForStatus(vm.VMStatusRunning, bltHomeDir, time.Minute)
+	env, name, err := newEphemeralEnvironment(opts.Preset)
 	if err != nil {
 		return err
 	}
 
-	stopIndeterminateProgressAnimation()
-	boldGreen.Println("Success")
+	opts.Preset = name
+	home := filepath.Dir(env.HomeDir())
 
-	err = resetBOSHStateJSON()
-	if err != nil {
-		return err
-	}
+	startTime := time.Now()
 
-	boldWhite.Println("Deploying Director...  ")
-	command = exec.Command(
-		"bosh", "create-env", filepath.Join(path.BoshDeploymentDir(bltHomeDir), "bosh.yml"),
-		"-o", filepath.Join(path.BoshDeploymentDir(bltHomeDir), "jumpbox-user.yml"),
-		"-o", filepath.Join(path.BoshOperationsDir(bltHomeDir), "runc-cpi.yml"),
-		"--state", path.BoshStateJSONPath(bltHomeDir),
-		"--vars-store", path.BoshCredsPath(bltHomeDir),
-		"-v", "director_name=director",
-		"-v", "external_cpid_ip=127.0.0.1",
-		"-v", "internal_cpid_ip=192.168.65.3",
-		"-v", "internal_nameserver=192.168.65.1",
-		"-v", "internal_ip=10.0.0.4",
-		"-v", "internal_gw=10.0.0.1",
-		"-v", "internal_cidr=10.0.0.0/16")
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-
-	err = command.Run()
+	err = env.Up(context.Background(), opts)
 	if err != nil {
+		fmt.Printf("%s the ephemeral environment is left in %s, delete it with: BLT_HOME=%s blt down\n", boldYellow.Sprint("Note:"), home, home)
 		return err
 	}
 
-	boldWhite.Printf("Configuring Director...  ")
-	configureBoshDirector()
-	boldGreen.Println("Success")
-
 	boldGreen.Printf("\nCompleted in %v\n\n", time.Since(startTime))
+	fmt.Printf(`Target the ephemeral environment with:
+
+$ export BLT_HOME=%s
+
+"blt down" deletes it along with everything in it.
+
+`, home)
 	return nil
 }
 
-func resetBOSHStateJSON() error {
-	_, err := os.Stat(path.BoshStateJSONPath(bltHomeDir))
-	if os.IsNotExist(err) {
-		return nil
+// newEphemeralEnvironment creates an ephemeral environment to take
+// the place of yours, returning it along with the preset to bring it
+// up with, the given one or else the one yours was last brought up with
+func newEphemeralEnvironment(name string) (*lit.Environment, string, error) {
+	status, _ := environment().Status(context.Background())
+	if status != vm.VMStatusStopped {
+		return nil, "", fmt.Errorf("your VM must be stopped for an ephemeral environment to take its place, it is currently: %s", status)
 	}
 
-	mapping := map[string]interface{}{}
+	if name == "" {
+		var err error
+		name, err = environment().CurrentPresetName()
+		if err != nil {
+			return nil, "", err
+		}
+	}
 
-	data, err := ioutil.ReadFile(path.BoshStateJSONPath(bltHomeDir))
+	env, err := lit.NewEphemeral(environmentOptions())
 	if err != nil {
-		return fmt.Errorf("failed to read bosh state file: %s", err)
+		return nil, "", err
+	}
+
+	return env, name, nil
+}
+
+// presentProgress prints the steps of the
+// operations of the environment as they go
+func presentProgress(p lit.Progress) {
+	if dryRun {
+		presentDryRunProgress(p)
+		return
 	}
 
-	json.Unmarshal(data, &mapping)
-	delete(mapping, "current_manifest_sha")
-	newContents, _ := json.Marshal(mapping)
+	switch p.State {
+	case lit.Started:
+		switch p.Step {
+		case lit.StepWait:
+			boldWhite.Print(p.Step)
+			go showIndeterminateProgressAnimation()
+		case lit.StepDeploy:
+			// bosh create-env prints its own progress
+			boldWhite.Println(p.Step + "...  ")
+		default:
+			boldWhite.Print(p.Step + "...   ")
+		}
+	case lit.Succeeded, lit.Failed:
+		if p.Step == lit.StepWait {
+			stopIndeterminateProgressAnimation()
+		}
+
+		switch {
+		case p.Step == lit.StepDeploy:
+		case p.State == lit.Succeeded:
+			boldGreen.Println("Success")
+		default:
+			boldRed.Println("Failed")
+		}
+	case lit.Warned:
+		boldYellow.Println(p.Message)
+	case lit.Info:
+		fmt.Print(p.Message)
+	case lit.Noted:
+		fmt.Printf("%s %s\n", boldYellow.Sprint("Note:"), p.Message)
+	}
+}
 
-	return ioutil.WriteFile(path.BoshStateJSONPath(bltHomeDir), newContents, 0600)
+// presentDryRunProgress prints every step on a line of
+// its own, followed by what the dry run would carry out
+func presentDryRunProgress(p lit.Progress) {
+	switch p.State {
+	case lit.Started:
+		boldWhite.Println(p.Step + "...")
+	case lit.Failed:
+		boldRed.Println("Failed")
+	case lit.Warned:
+		boldYellow.Println("  " + p.Message)
+	case lit.Info:
+		fmt.Print(p.Message)
+	case lit.Noted:
+		fmt.Printf("%s %s\n", boldYellow.Sprint("Note:"), p.Message)
+	}
 }
 
 func printMessages(messageChan chan string) {
@@ -209,7 +251,7 @@ func printMessages(messageChan chan string) {
 		case <-doneChan:
 			return
 		case m := <-messageChan:
-			fmt.Printf(m)
+			fmt.Print(m)
 		}
 	}
 }
@@ -217,7 +259,7 @@ func showIndeterminateProgressAnimation() {
 	var (
 		toggle     bool
 		clearChars = "\b\b\b\b\b\b"
-		ticker     = time.NewTicker(500*time.Millisecond)
+		ticker     = time.NewTicker(500 * time.Millisecond)
 	)
 
 	boldWhite.Print("...   ")
@@ -241,121 +283,3 @@ func showIndeterminateProgressAnimation() {
 func stopIndeterminateProgressAnimation() {
 	doneChan <- true
 }
-
-func configureBoshDirector() error {
-	commands := []string{
-		fmt.Sprintf("bosh int %s --path /director_ssl/ca > %s", path.BoshCredsPath(bltHomeDir), path.BoshCACertPath(bltHomeDir)),
-		fmt.Sprintf("bosh int %s --path /jumpbox_ssh/private_key > %s", path.BoshCredsPath(bltHomeDir), path.BoshGWPrivateKeyPath(bltHomeDir)),
-		fmt.Sprintf("chmod 0600 %s", path.BoshGWPrivateKeyPath(bltHomeDir)),
-	}
-
-	for _, command := range commands {
-		output, err := exec.Command("bash", "-c", command).CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to execute '%s': %s: %s", command, err, output)
-		}
-	}
-
-	cmd := fmt.Sprintf(`eval "%s"; bosh cloud-config`, fetchEnvironmentVariables())
-	err := exec.Command("bash", "-c", cmd).Run()
-	if err == nil {
-		return nil
-	}
-
-	cmd = fmt.Sprintf(`eval "%s"; bosh -n update-cloud-config %s`, fetchEnvironmentVariables(), filepath.Join(path.BoshOperationsDir(bltHomeDir), "cloud-config.yml"))
-	output, err := exec.Command("bash", "-c", cmd).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to execute '%s': %s: %s", cmd, err, output)
-	}
-
-	return nil
-}
-
-func checkNeedsUpdates() bool {
-	if version == "DEV" {
-		return false
-	}
-
-	contents, err := ioutil.ReadFile(path.AssetVersionPath(bltHomeDir))
-	if err != nil {
-		return true
-	}
-
-	return strings.TrimSpace(string(contents)) != version
-}
-
-func checkNetworkAddrs() error {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return fmt.Errorf("failed to inspect network interfaces: %s", err)
-	}
-
-	for _, addr := range addrs {
-		elements := strings.Split(addr.String(), "/")
-		if elements[0] == "10.0.0.4" {
-			return nil
-		}
-	}
-
-	return fmt.Errorf(`Your BOSH director will be accessible at %s. To make sure your requests
-target appropriately you must add the IP to your network interfaces, like so:
-
-$ %s
-
-`, boldWhite.Sprint("10.0.0.4"), boldWhite.Sprint("sudo ifconfig lo0 alias 10.0.0.4"))
-}
-
-type Dependency struct {
-	Name         string
-	CheckCommand string
-	Site         string
-}
-
-func (d *Dependency) Usage() string {
-	if d.Site == "" {
-		return boldWhite.Sprintf(strings.Title(d.Name))
-	}
-
-	return fmt.Sprintf("%s %s", boldWhite.Sprintf(strings.Title(d.Name)), d.Site)
-}
-
-func checkForDependencies() error {
-	var missingDeps []Dependency
-	var allDeps = []Dependency{
-		{
-			Name:         "docker",
-			CheckCommand: "docker -v",
-			Site:         "https://store.docker.com/editions/community/docker-ce-desktop-mac",
-		},
-		{
-			Name:         "bosh",
-			CheckCommand: "bosh -v",
-			Site:         "https://bosh.io/docs/cli-v2",
-		},
-		{
-			Name:         "linuxkit",
-			CheckCommand: "linuxkit version",
-			Site:         "https://github.com/linuxkit/linuxkit",
-		},
-		{
-			Name:         "tar",
-			CheckCommand: "tar --help",
-		},
-	}
-
-	for _, d := range allDeps {
-		if err := exec.Command("/bin/sh", "-c", d.CheckCommand).Run(); err != nil {
-			missingDeps = append(missingDeps, d)
-		}
-	}
-
-	if len(missingDeps) == 0 {
-		return nil
-	}
-
-	var messages = []string{"The following dependencies must be installed:"}
-	for i, d := range missingDeps {
-		messages = append(messages, fmt.Sprintf("%d: %s", i, d.Usage()))
-	}
-	return errors.New(strings.Join(messages, "\n"))
-}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+)
+
+type Config struct {
+	Network   Network `yaml:"network"`
+	DNS       DNS     `yaml:"dns"`
+	HostsFile string  `yaml:"hosts_file"`
+	Runtime   string  `yaml:"runtime"`
+}
+
+// Runtimes run the VM on hyperkit, either the one that comes
+// with Docker for Mac or one that is installed on its own
+const (
+	RuntimeDocker   = "docker"
+	RuntimeHyperkit = "hyperkit"
+)
+
+const DefaultRuntime = RuntimeDocker
+
+// Network describes the network that the BOSH director and its
+// deployments live on. The nameserver and cpi address belong
+// to the network that vpnkit provides to the VM.
+type Network struct {
+	DirectorIP string `yaml:"director_ip"`
+	CIDR       string `yaml:"cidr"`
+	Gateway    string `yaml:"gateway"`
+	Nameserver string `yaml:"nameserver"`
+	CPIIP      string `yaml:"cpi_ip"`
+}
+
+var DefaultNetwork = Network{
+	DirectorIP: "10.0.0.4",
+	CIDR:       "10.0.0.0/16",
+	Gateway:    "10.0.0.1",
+	Nameserver: "192.168.65.1",
+	CPIIP:      "192.168.65.3",
+}
+
+// DNS describes the resolver of "blt dns serve", answering for
+// names under the suffix and forwarding the rest to the upstream.
+// Records map names, which may start with a "*." wildcard, to
+// either an IP or an instance like deployment/group[/index].
+type DNS struct {
+	Suffix   string            `yaml:"suffix"`
+	Listen   string            `yaml:"listen"`
+	Upstream string            `yaml:"upstream"`
+	Records  map[string]string `yaml:"records"`
+}
+
+var DefaultDNS = DNS{
+	Suffix: "blt.local",
+	Listen: "127.0.0.1:1053",
+}
+
+const DefaultHostsFile = "/etc/hosts"
+
+// Load reads the configuration file at the given path, if any,
+// filling in defaults for everything that is left out
+func Load(file string) (Config, error) {
+	c := Config{Network: DefaultNetwork, DNS: DefaultDNS, HostsFile: DefaultHostsFile, Runtime: DefaultRuntime}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read %s: %s", file, err)
+	}
+
+	var overrides Config
+	err = yaml.UnmarshalStrict(data, &overrides)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+
+	c.Network = c.Network.merge(overrides.Network)
+
+	err = c.Network.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid network in %s: %s", file, err)
+	}
+
+	if overrides.HostsFile != "" {
+		c.HostsFile = overrides.HostsFile
+	}
+
+	if overrides.Runtime != "" {
+		c.Runtime = overrides.Runtime
+	}
+
+	if c.Runtime != RuntimeDocker && c.Runtime != RuntimeHyperkit {
+		return Config{}, fmt.Errorf("invalid runtime in %s: '%s' must be either %s or %s", file, c.Runtime, RuntimeDocker, RuntimeHyperkit)
+	}
+
+	c.DNS = c.DNS.merge(overrides.DNS)
+
+	err = c.DNS.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid dns in %s: %s", file, err)
+	}
+
+	return c, nil
+}
+
+func (d DNS) merge(overrides DNS) DNS {
+	if overrides.Suffix != "" {
+		d.Suffix = strings.Trim(strings.ToLower(overrides.Suffix), ".")
+	}
+
+	if overrides.Listen != "" {
+		d.Listen = overrides.Listen
+	}
+
+	if overrides.Upstream != "" {
+		d.Upstream = overrides.Upstream
+	}
+
+	if overrides.Records != nil {
+		d.Records = map[string]string{}
+		for name, value := range overrides.Records {
+			d.Records[strings.Trim(strings.ToLower(name), ".")] = value
+		}
+	}
+
+	return d
+}
+
+func (d DNS) Validate() error {
+	if d.Suffix == "" {
+		return fmt.Errorf("suffix must not be empty")
+	}
+
+	_, _, err := net.SplitHostPort(d.Listen)
+	if err != nil {
+		return fmt.Errorf("listen '%s' must be of the form ip:port", d.Listen)
+	}
+
+	if d.Upstream != "" {
+		_, _, err = net.SplitHostPort(d.Upstream)
+		if err != nil {
+			return fmt.Errorf("upstream '%s' must be of the form ip:port", d.Upstream)
+		}
+	}
+
+	for name, value := range d.Records {
+		if name != d.Suffix && !strings.HasSuffix(name, "."+d.Suffix) {
+			return fmt.Errorf("record '%s' is not under the suffix '%s'", name, d.Suffix)
+		}
+
+		if net.ParseIP(value) == nil && len(strings.Split(value, "/")) < 2 {
+			return fmt.Errorf("record '%s' must point to an IP or an instance like deployment/group[/index], not '%s'", name, value)
+		}
+	}
+
+	return nil
+}
+
+func (n Network) merge(overrides Network) Network {
+	if overrides.DirectorIP != "" {
+		n.DirectorIP = overrides.DirectorIP
+	}
+
+	if overrides.CIDR != "" {
+		n.CIDR = overrides.CIDR
+	}
+
+	if overrides.Gateway != "" {
+		n.Gateway = overrides.Gateway
+	}
+
+	if overrides.Nameserver != "" {
+		n.Nameserver = overrides.Nameserver
+	}
+
+	if overrides.CPIIP != "" {
+		n.CPIIP = overrides.CPIIP
+	}
+
+	return n
+}
+
+func (n Network) IsDefault() bool {
+	return n == DefaultNetwork
+}
+
+func (n Network) Validate() error {
+	_, subnet, err := net.ParseCIDR(n.CIDR)
+	if err != nil {
+		return fmt.Errorf("cidr '%s' is not valid", n.CIDR)
+	}
+
+	for name, ip := range map[string]string{"director_ip": n.DirectorIP, "gateway": n.Gateway} {
+		addr := net.ParseIP(ip)
+		if addr == nil || addr.To4() == nil {
+			return fmt.Errorf("%s '%s' is not a valid IPv4 address", name, ip)
+		}
+
+		if !subnet.Contains(addr) {
+			return fmt.Errorf("%s '%s' is not within %s", name, ip, n.CIDR)
+		}
+	}
+
+	if n.DirectorIP == n.Gateway {
+		return fmt.Errorf("director_ip and gateway must differ")
+	}
+
+	for name, ip := range map[string]string{"nameserver": n.Nameserver, "cpi_ip": n.CPIIP} {
+		addr := net.ParseIP(ip)
+		if addr == nil || addr.To4() == nil {
+			return fmt.Errorf("%s '%s' is not a valid IPv4 address", name, ip)
+		}
+	}
+
+	return nil
+}
+
+// Subnet returns the parsed CIDR of a validated network
+func (n Network) Subnet() *net.IPNet {
+	_, subnet, _ := net.ParseCIDR(n.CIDR)
+	return subnet
+}
+
+var cloudConfigTemplate = template.Must(template.New("cloud-config").Parse(`azs:
+- name: z1
+- name: z2
+- name: z3
+
+vm_types:
+- name: default
+
+disk_types:
+- name: default
+  disk_size: 1024
+
+networks:
+- name: default
+  type: manual
+  subnets:
+  - azs: [z1, z2, z3]
+    range: {{.CIDR}}
+    gateway: {{.Gateway}}
+    reserved: [{{.DirectorIP}}]
+    dns: [{{.Nameserver}}]
+
+compilation:
+  workers: 4
+  az: z1
+  reuse_compilation_vms: true
+  vm_type: default
+  network: default
+`))
+
+// CloudConfig returns a minimal cloud-config for the network
+func (n Network) CloudConfig() []byte {
+	var buf bytes.Buffer
+	cloudConfigTemplate.Execute(&buf, n)
+	return buf.Bytes()
+}
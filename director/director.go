@@ -0,0 +1,211 @@
+package director
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to the HTTP API of a BOSH director,
+// authenticating either as a local user or a UAA client
+type Client struct {
+	url          string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	token        string
+}
+
+type Info struct {
+	Name               string `json:"name"`
+	UUID               string `json:"uuid"`
+	Version            string `json:"version"`
+	UserAuthentication struct {
+		Type    string `json:"type"`
+		Options struct {
+			URL string `json:"url"`
+		} `json:"options"`
+	} `json:"user_authentication"`
+}
+
+type Deployment struct {
+	Name string `json:"name"`
+}
+
+type VM struct {
+	AgentID string   `json:"agent_id"`
+	CID     string   `json:"cid"`
+	Job     string   `json:"job"`
+	Index   int      `json:"index"`
+	ID      string   `json:"id"`
+	AZ      string   `json:"az"`
+	IPs     []string `json:"ips"`
+}
+
+// Name returns the instance name in the "group/id" form
+func (v VM) Name() string {
+	return v.Job + "/" + v.ID
+}
+
+// Matches returns whether the VM is selected by an instance
+// reference of the "group", "group/index" or "group/id" form
+func (v VM) Matches(instance string) bool {
+	parts := strings.SplitN(instance, "/", 2)
+	if parts[0] != v.Job {
+		return false
+	}
+
+	return len(parts) == 1 || parts[1] == v.ID || parts[1] == fmt.Sprint(v.Index)
+}
+
+func New(ip string, caCert []byte, clientID string, clientSecret string) (*Client, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("failed to load the director CA certificate")
+	}
+
+	return &Client{
+		url:          fmt.Sprintf("https://%s:25555", ip),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+func (c *Client) Info() (Info, error) {
+	var info Info
+	err := c.get("/info", false, &info)
+	return info, err
+}
+
+func (c *Client) Deployments() ([]Deployment, error) {
+	var deployments []Deployment
+	err := c.get("/deployments", true, &deployments)
+	return deployments, err
+}
+
+// Manifest returns the manifest the deployment was last deployed with
+func (c *Client) Manifest(deployment string) (string, error) {
+	var result struct {
+		Manifest string `json:"manifest"`
+	}
+
+	err := c.get("/deployments/"+url.PathEscape(deployment), true, &result)
+	return result.Manifest, err
+}
+
+func (c *Client) VMs(deployment string) ([]VM, error) {
+	var vms []VM
+	err := c.get("/deployments/"+url.PathEscape(deployment)+"/vms", true, &vms)
+	return vms, err
+}
+
+func (c *Client) get(path string, authenticated bool, result interface{}) error {
+	return c.request(path, authenticated, false, result)
+}
+
+func (c *Client) request(path string, authenticated bool, retried bool, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if authenticated {
+		err = c.authenticate(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the director: %s", err)
+	}
+	defer resp.Body.Close()
+
+	// tokens expire while watching, so authenticate once more
+	if resp.StatusCode == http.StatusUnauthorized && authenticated && c.token != "" && !retried {
+		c.token = ""
+		return c.request(path, authenticated, true, result)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s: %s", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received [%s] for %s: %s", resp.Status, path, strings.TrimSpace(string(body)))
+	}
+
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return fmt.Errorf("failed to parse response of %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func (c *Client) authenticate(req *http.Request) error {
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+		return nil
+	}
+
+	info, err := c.Info()
+	if err != nil {
+		return err
+	}
+
+	if info.UserAuthentication.Type != "uaa" {
+		req.SetBasicAuth(c.clientID, c.clientSecret)
+		c.token = req.Header.Get("Authorization")
+		return nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	tokenReq, err := http.NewRequest(http.MethodPost, info.UserAuthentication.Options.URL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	tokenReq.SetBasicAuth(c.clientID, c.clientSecret)
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(tokenReq)
+	if err != nil {
+		return fmt.Errorf("failed to reach the director UAA: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received [%s] when authenticating with the director UAA", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("failed to parse the director UAA token: %s", err)
+	}
+
+	c.token = "Bearer " + token.AccessToken
+	req.Header.Set("Authorization", c.token)
+	return nil
+}
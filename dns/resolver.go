@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/hostnet"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ResolverInstaller returns the per-domain resolver configuration
+// that sends queries for names under the suffix to the server
+func ResolverInstaller(suffix string, listen string) (hostnet.Installer, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return hostnet.Installer{}, err
+	}
+
+	if runtime.GOOS == "darwin" {
+		return hostnet.Installer{
+			Path:     "/etc/resolver/" + suffix,
+			Contents: fmt.Sprintf("# Added by BOSH Lit\nnameserver %s\nport %s\n", host, port),
+		}, nil
+	}
+
+	// the port may only be left out when it is the standard one
+	server := listen
+	if port == "53" {
+		server = host
+	}
+
+	return hostnet.Installer{
+		Path:     "/etc/systemd/resolved.conf.d/blt.conf",
+		Contents: fmt.Sprintf("# Added by BOSH Lit\n[Resolve]\nDNS=%s\nDomains=~%s\n", server, suffix),
+		Enable:   "systemctl restart systemd-resolved",
+		Disable:  "systemctl restart systemd-resolved",
+	}, nil
+}
+
+// CheckResolver makes sure that the resolver configuration of this
+// machine can send queries to the server. systemd-resolved only takes
+// nameservers on ports other than 53 from systemd 246 on.
+func CheckResolver(listen string) error {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "darwin" || port == "53" {
+		return nil
+	}
+
+	version, err := systemdVersion()
+	if err != nil {
+		return fmt.Errorf("failed to find out the version of systemd: %s", err)
+	}
+
+	if version < 246 {
+		return fmt.Errorf("systemd-resolved only sends queries to ports other than 53 from systemd 246 on, found systemd %d. Set the listen address of dns in config.yml to port 53, or use 'blt hosts sync' instead", version)
+	}
+
+	return nil
+}
+
+// systemdVersion returns the version of systemd, which is
+// what `systemctl --version` prints first, as in "systemd 245 (245.4)"
+func systemdVersion() (int, error) {
+	output, err := exec.Command("systemctl", "--version").Output()
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0, fmt.Errorf("unexpected output: %s", output)
+	}
+
+	return strconv.Atoi(fields[1])
+}
@@ -0,0 +1,194 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Server answers A queries for names under the suffix with the
+// addresses returned by Lookup, and relays every other query
+// to the upstream nameserver
+type Server struct {
+	Suffix   string
+	Upstream string
+
+	// Lookup returns the addresses of a name under the suffix,
+	// with no addresses meaning that the name does not exist
+	Lookup func(name string) ([]net.IP, error)
+
+	// Log, when set, is given a line for every query answered
+	Log func(line string)
+
+	mutex sync.Mutex
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %s", addr, err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 512)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		query := make([]byte, n)
+		copy(query, buf[:n])
+
+		go func() {
+			response, err := s.handle(query)
+			if err != nil {
+				s.log(err.Error())
+				return
+			}
+
+			conn.WriteTo(response, client)
+		}()
+	}
+}
+
+func (s *Server) handle(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("received malformed query: %s", err)
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return nil, fmt.Errorf("received query without question: %s", err)
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	if name != s.Suffix && !strings.HasSuffix(name, "."+s.Suffix) {
+		return s.relay(query)
+	}
+
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+
+	ips, err := s.Lookup(name)
+	switch {
+	case err != nil:
+		response.Header.RCode = dnsmessage.RCodeServerFailure
+		s.log(fmt.Sprintf("%s: %s", name, err))
+	case len(ips) == 0:
+		response.Header.RCode = dnsmessage.RCodeNameError
+		s.log(fmt.Sprintf("%s: not found", name))
+	default:
+		s.log(fmt.Sprintf("%s: %s", name, joinIPs(ips)))
+	}
+
+	if question.Type == dnsmessage.TypeA || question.Type == dnsmessage.TypeALL {
+		for _, ip := range ips {
+			if ip.To4() == nil {
+				continue
+			}
+
+			var a dnsmessage.AResource
+			copy(a.A[:], ip.To4())
+
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  question.Name,
+					Type:  dnsmessage.TypeA,
+					Class: dnsmessage.ClassINET,
+					TTL:   5,
+				},
+				Body: &a,
+			})
+		}
+	}
+
+	return response.Pack()
+}
+
+func (s *Server) relay(query []byte) ([]byte, error) {
+	if s.Upstream == "" {
+		return nil, errors.New("no upstream nameserver to relay queries to")
+	}
+
+	conn, err := net.DialTimeout("udp", s.Upstream, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach upstream nameserver %s: %s", s.Upstream, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to relay query to %s: %s", s.Upstream, err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %s: %s", s.Upstream, err)
+	}
+
+	return buf[:n], nil
+}
+
+func (s *Server) log(line string) {
+	if s.Log == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Log(line)
+}
+
+// SystemUpstream returns the first nameserver of the host
+// that is not on a loopback address, as ip:port
+func SystemUpstream() (string, error) {
+	data, err := ioutil.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("failed to read nameservers of your machine: %s", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+
+		ip := net.ParseIP(fields[1])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+
+		return net.JoinHostPort(ip.String(), "53"), nil
+	}
+
+	return "", errors.New("no nameserver found in /etc/resolv.conf, set one as dns.upstream in config.yml")
+}
+
+func joinIPs(ips []net.IP) string {
+	var result []string
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,173 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rule is a forward that is remembered, so that it can be
+// applied again whenever the VM is brought back up. It is
+// either a declaration understood by Parse (or ParseReverse
+// when reversed), or ports of a BOSH instance whose IPs
+// are resolved when applied.
+type Rule struct {
+	Declaration string `json:"declaration,omitempty"`
+	Reverse     bool   `json:"reverse,omitempty"`
+
+	Deployment string `json:"deployment,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	Ports      string `json:"ports,omitempty"`
+
+	// Applied holds the specs last forwarded for the rule
+	Applied []string `json:"applied,omitempty"`
+}
+
+func (r Rule) IsInstance() bool {
+	return r.Deployment != ""
+}
+
+func (r Rule) String() string {
+	if r.IsInstance() {
+		return fmt.Sprintf("%s/%s -p %s", r.Deployment, r.Instance, r.Ports)
+	}
+
+	if r.Reverse {
+		return "reverse " + r.Declaration
+	}
+
+	return r.Declaration
+}
+
+// InstanceSpecs returns the specs that forward the ports of the rule,
+// given as <port>[:<hostport>], from each of the instance IPs
+func (r Rule) InstanceSpecs(ips []string) ([]Spec, error) {
+	ports, protocol := r.Ports, ""
+	if i := strings.LastIndex(ports, "/"); i >= 0 {
+		ports, protocol = ports[:i], ports[i:]
+	}
+
+	fields := strings.Split(ports, ":")
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid ports '%s': expected <port>[:<hostport>]", r.Ports)
+	}
+
+	containerPorts, hostPorts := fields[0], fields[0]
+	if len(fields) == 2 {
+		hostPorts = fields[1]
+	}
+
+	var specs []Spec
+	for _, ip := range ips {
+		s, err := Parse(fmt.Sprintf("%s:%s:%s:%s%s", bracket(ip), hostPorts, bracket(ip), containerPorts, protocol), "")
+		if err != nil {
+			return nil, err
+		}
+
+		specs = append(specs, s...)
+	}
+
+	return specs, nil
+}
+
+// LoadRules reads the rules saved at the given file,
+// which is not required to exist
+func LoadRules(file string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+
+	return rules, nil
+}
+
+// SaveRules replaces the contents of the given file
+// with the rules, without leaving it half written
+func SaveRules(file string, rules []Rule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := file + ".tmp"
+	err = ioutil.WriteFile(tmpFile, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
+}
+
+// AddRule returns the rules with the given one appended,
+// in place of any earlier rule that forwards the same thing
+func AddRule(rules []Rule, rule Rule) []Rule {
+	for i, r := range rules {
+		if r.Same(rule) {
+			rules[i] = rule
+			return rules
+		}
+	}
+
+	return append(rules, rule)
+}
+
+// FindRule returns the rule that forwards the same thing as the given one
+func FindRule(rules []Rule, rule Rule) (Rule, bool) {
+	for _, r := range rules {
+		if r.Same(rule) {
+			return r, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// Same tells whether both rules forward the same thing,
+// regardless of the specs that they were last applied as
+func (r Rule) Same(other Rule) bool {
+	return r.Declaration == other.Declaration && r.Reverse == other.Reverse && r.Deployment == other.Deployment &&
+		r.Instance == other.Instance && r.Ports == other.Ports
+}
+
+// AppliedSpecs parses the specs that the rule was last applied as
+func (r Rule) AppliedSpecs() ([]Spec, error) {
+	var specs []Spec
+	for _, a := range r.Applied {
+		var (
+			s   []Spec
+			err error
+		)
+
+		if r.Reverse {
+			s, err = ParseReverse(a)
+		} else {
+			s, err = Parse(a, "")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		specs = append(specs, s...)
+	}
+
+	return specs, nil
+}
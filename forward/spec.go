@@ -0,0 +1,270 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+// Spec describes a single port forwarded from the VM network
+// to the host or, when reversed, from the host to the VM network
+type Spec struct {
+	HostIP        string
+	HostPort      int
+	ContainerIP   string
+	ContainerPort int
+	Protocol      string
+	Reverse       bool
+}
+
+// String formats the spec the way the vpnkit-manager expects it,
+// with IPv6 addresses in brackets and the listening side first
+func (s Spec) String() string {
+	result := fmt.Sprintf("%s:%d:%s:%d", bracket(s.HostIP), s.HostPort, bracket(s.ContainerIP), s.ContainerPort)
+	if s.Reverse {
+		result = fmt.Sprintf("%s:%d:%s:%d", bracket(s.ContainerIP), s.ContainerPort, bracket(s.HostIP), s.HostPort)
+	}
+
+	if s.Protocol == UDP {
+		result += "/" + UDP
+	}
+
+	return result
+}
+
+// Parse validates a forward declaration and expands
+// any port range into the individual specs. Accepted forms are:
+//
+//	host_ip:port:container_ip:port
+//	ip:port                           (same address on both ends)
+//	port                              (a port of the director at defaultIP)
+//
+// where ports may be ranges like 61000-61010, IPv6 addresses must
+// be enclosed in brackets, and a /tcp or /udp suffix may follow.
+func Parse(declaration string, defaultIP string) ([]Spec, error) {
+	specs, err := parse(declaration, defaultIP, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward '%s': %s", declaration, err)
+	}
+
+	return specs, nil
+}
+
+// ParseReverse validates a reverse forward declaration, which
+// makes a port of the host reachable on an IP of the VM network:
+//
+//	container_ip:port:host_address:port
+//	container_ip:port                 (the same port on 127.0.0.1 of the host)
+func ParseReverse(declaration string) ([]Spec, error) {
+	specs, err := parse(declaration, "", true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reverse forward '%s': %s", declaration, err)
+	}
+
+	return specs, nil
+}
+
+// ParseAll parses every declaration, see Parse
+func ParseAll(declarations []string, defaultIP string) ([]Spec, error) {
+	var specs []Spec
+	for _, d := range declarations {
+		s, err := Parse(d, defaultIP)
+		if err != nil {
+			return nil, err
+		}
+
+		specs = append(specs, s...)
+	}
+
+	return specs, nil
+}
+
+// Strings formats every spec, see Spec.String
+func Strings(specs []Spec) []string {
+	var result []string
+	for _, s := range specs {
+		result = append(result, s.String())
+	}
+
+	return result
+}
+
+func parse(declaration string, defaultIP string, reverse bool) ([]Spec, error) {
+	protocol := TCP
+	if i := strings.LastIndex(declaration, "/"); i >= 0 {
+		protocol = strings.ToLower(declaration[i+1:])
+		declaration = declaration[:i]
+
+		if protocol != TCP && protocol != UDP {
+			return nil, fmt.Errorf("protocol '%s' must be either tcp or udp", protocol)
+		}
+	}
+
+	if strings.Contains(declaration, "::") && !strings.Contains(declaration, "[") {
+		return nil, fmt.Errorf("IPv6 addresses must be enclosed in brackets, like [::1]")
+	}
+
+	fields, err := split(declaration)
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		switch len(fields) {
+		case 2:
+			fields = []string{"127.0.0.1", fields[1], fields[0], fields[1]}
+		case 4:
+			fields = []string{fields[2], fields[3], fields[0], fields[1]}
+		default:
+			return nil, fmt.Errorf("expected container_ip:port:host_address:port or container_ip:port, with IPv6 addresses in brackets")
+		}
+	}
+
+	switch len(fields) {
+	case 1:
+		fields = []string{defaultIP, fields[0], defaultIP, fields[0]}
+	case 2:
+		fields = []string{fields[0], fields[1], fields[0], fields[1]}
+	case 4:
+	default:
+		return nil, fmt.Errorf("expected host_ip:port:container_ip:port, ip:port or port, with IPv6 addresses in brackets")
+	}
+
+	hostIP, err := parseIP("host", fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	containerIP, err := parseIP("container", fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	hostStart, hostEnd, err := parsePorts("host", fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	containerStart, containerEnd, err := parsePorts("container", fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	if hostEnd-hostStart != containerEnd-containerStart {
+		return nil, fmt.Errorf("host port range '%s' and container port range '%s' must be of the same size", fields[1], fields[3])
+	}
+
+	var specs []Spec
+	for offset := 0; offset <= hostEnd-hostStart; offset++ {
+		specs = append(specs, Spec{
+			HostIP:        hostIP,
+			HostPort:      hostStart + offset,
+			ContainerIP:   containerIP,
+			ContainerPort: containerStart + offset,
+			Protocol:      protocol,
+			Reverse:       reverse,
+		})
+	}
+
+	return specs, nil
+}
+
+// split separates the fields of a declaration on colons,
+// except for those within bracketed IPv6 addresses
+func split(declaration string) ([]string, error) {
+	var (
+		fields  []string
+		current strings.Builder
+		inside  bool
+	)
+
+	for _, c := range declaration {
+		switch {
+		case c == '[' && !inside:
+			inside = true
+		case c == ']' && inside:
+			inside = false
+		case c == ':' && !inside:
+			fields = append(fields, current.String())
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(c)
+	}
+
+	if inside {
+		return nil, fmt.Errorf("unterminated '[' in IPv6 address")
+	}
+
+	return append(fields, current.String()), nil
+}
+
+func parseIP(side string, field string) (string, error) {
+	if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+		ip := net.ParseIP(field[1 : len(field)-1])
+		if ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("%s address '%s' is not a valid IPv6 address", side, field)
+		}
+
+		return ip.String(), nil
+	}
+
+	ip := net.ParseIP(field)
+	if ip == nil {
+		return "", fmt.Errorf("%s address '%s' is not a valid IP address", side, field)
+	}
+
+	if ip.To4() == nil {
+		return "", fmt.Errorf("%s address '%s' must be enclosed in brackets, like [%s]", side, field, field)
+	}
+
+	return ip.String(), nil
+}
+
+func parsePorts(side string, field string) (int, int, error) {
+	bounds := strings.SplitN(field, "-", 2)
+
+	start, err := parsePort(side, bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(bounds) == 1 {
+		return start, start, nil
+	}
+
+	end, err := parsePort(side, bounds[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if end < start {
+		return 0, 0, fmt.Errorf("%s port range '%s' must be ascending", side, field)
+	}
+
+	return start, end, nil
+}
+
+func parsePort(side string, field string) (int, error) {
+	port, err := strconv.Atoi(field)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%s port '%s' must be a number between 1 and 65535", side, field)
+	}
+
+	return port, nil
+}
+
+func bracket(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+
+	return ip
+}
@@ -0,0 +1,217 @@
+package forward
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		declaration string
+		expected    []Spec
+		err         string
+	}{
+		{
+			name:        "forwards a port of the director",
+			declaration: "8080",
+			expected:    []Spec{{HostIP: "10.0.0.4", HostPort: 8080, ContainerIP: "10.0.0.4", ContainerPort: 8080, Protocol: TCP}},
+		},
+		{
+			name:        "forwards the same address on both ends",
+			declaration: "10.244.0.2:8080",
+			expected:    []Spec{{HostIP: "10.244.0.2", HostPort: 8080, ContainerIP: "10.244.0.2", ContainerPort: 8080, Protocol: TCP}},
+		},
+		{
+			name:        "forwards a host address to a container address",
+			declaration: "127.0.0.1:8080:10.244.0.2:80",
+			expected:    []Spec{{HostIP: "127.0.0.1", HostPort: 8080, ContainerIP: "10.244.0.2", ContainerPort: 80, Protocol: TCP}},
+		},
+		{
+			name:        "expands port ranges",
+			declaration: "127.0.0.1:61000-61002:10.244.0.2:62000-62002",
+			expected: []Spec{
+				{HostIP: "127.0.0.1", HostPort: 61000, ContainerIP: "10.244.0.2", ContainerPort: 62000, Protocol: TCP},
+				{HostIP: "127.0.0.1", HostPort: 61001, ContainerIP: "10.244.0.2", ContainerPort: 62001, Protocol: TCP},
+				{HostIP: "127.0.0.1", HostPort: 61002, ContainerIP: "10.244.0.2", ContainerPort: 62002, Protocol: TCP},
+			},
+		},
+		{
+			name:        "takes a udp suffix",
+			declaration: "127.0.0.1:53:10.244.0.2:53/udp",
+			expected:    []Spec{{HostIP: "127.0.0.1", HostPort: 53, ContainerIP: "10.244.0.2", ContainerPort: 53, Protocol: UDP}},
+		},
+		{
+			name:        "takes a tcp suffix in any case",
+			declaration: "10.244.0.2:80/TCP",
+			expected:    []Spec{{HostIP: "10.244.0.2", HostPort: 80, ContainerIP: "10.244.0.2", ContainerPort: 80, Protocol: TCP}},
+		},
+		{
+			name:        "takes bracketed IPv6 addresses",
+			declaration: "[::1]:8080:[fd00::2]:80",
+			expected:    []Spec{{HostIP: "::1", HostPort: 8080, ContainerIP: "fd00::2", ContainerPort: 80, Protocol: TCP}},
+		},
+		{
+			name:        "takes a bracketed IPv6 address on both ends",
+			declaration: "[fd00::2]:8080/udp",
+			expected:    []Spec{{HostIP: "fd00::2", HostPort: 8080, ContainerIP: "fd00::2", ContainerPort: 8080, Protocol: UDP}},
+		},
+		{
+			name:        "fails on port ranges of different sizes",
+			declaration: "127.0.0.1:61000-61002:10.244.0.2:62000-62001",
+			err:         "invalid forward '127.0.0.1:61000-61002:10.244.0.2:62000-62001': host port range '61000-61002' and container port range '62000-62001' must be of the same size",
+		},
+		{
+			name:        "fails on descending port ranges",
+			declaration: "10.244.0.2:8082-8080",
+			err:         "invalid forward '10.244.0.2:8082-8080': host port range '8082-8080' must be ascending",
+		},
+		{
+			name:        "fails on unbracketed IPv6 addresses",
+			declaration: "::1:8080:10.244.0.2:80",
+			err:         "invalid forward '::1:8080:10.244.0.2:80': IPv6 addresses must be enclosed in brackets, like [::1]",
+		},
+		{
+			name:        "fails on an unterminated bracket",
+			declaration: "[::1:8080",
+			err:         "invalid forward '[::1:8080': unterminated '[' in IPv6 address",
+		},
+		{
+			name:        "fails on bracketed IPv4 addresses",
+			declaration: "[10.244.0.2]:8080",
+			err:         "invalid forward '[10.244.0.2]:8080': host address '[10.244.0.2]' is not a valid IPv6 address",
+		},
+		{
+			name:        "fails on host names",
+			declaration: "localhost:8080",
+			err:         "invalid forward 'localhost:8080': host address 'localhost' is not a valid IP address",
+		},
+		{
+			name:        "fails on port zero",
+			declaration: "127.0.0.1:0:10.244.0.2:80",
+			err:         "invalid forward '127.0.0.1:0:10.244.0.2:80': host port '0' must be a number between 1 and 65535",
+		},
+		{
+			name:        "fails on ports above 65535",
+			declaration: "127.0.0.1:8080:10.244.0.2:65536",
+			err:         "invalid forward '127.0.0.1:8080:10.244.0.2:65536': container port '65536' must be a number between 1 and 65535",
+		},
+		{
+			name:        "fails on ports that are not numbers",
+			declaration: "http",
+			err:         "invalid forward 'http': host port 'http' must be a number between 1 and 65535",
+		},
+		{
+			name:        "fails on unknown protocols",
+			declaration: "10.244.0.2:8080/sctp",
+			err:         "invalid forward '10.244.0.2:8080/sctp': protocol 'sctp' must be either tcp or udp",
+		},
+		{
+			name:        "fails on a wrong number of fields",
+			declaration: "127.0.0.1:8080:10.244.0.2",
+			err:         "invalid forward '127.0.0.1:8080:10.244.0.2': expected host_ip:port:container_ip:port, ip:port or port, with IPv6 addresses in brackets",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Parse(test.declaration, "10.0.0.4")
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got: %v", test.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseReverse(t *testing.T) {
+	tests := []struct {
+		name        string
+		declaration string
+		expected    []Spec
+		err         string
+	}{
+		{
+			name:        "forwards the same port on the loopback of the host",
+			declaration: "10.244.0.9:5432",
+			expected:    []Spec{{HostIP: "127.0.0.1", HostPort: 5432, ContainerIP: "10.244.0.9", ContainerPort: 5432, Protocol: TCP, Reverse: true}},
+		},
+		{
+			name:        "forwards a container address to a host address",
+			declaration: "10.244.0.9:80:192.168.1.5:8080",
+			expected:    []Spec{{HostIP: "192.168.1.5", HostPort: 8080, ContainerIP: "10.244.0.9", ContainerPort: 80, Protocol: TCP, Reverse: true}},
+		},
+		{
+			name:        "fails on a wrong number of fields",
+			declaration: "5432",
+			err:         "invalid reverse forward '5432': expected container_ip:port:host_address:port or container_ip:port, with IPv6 addresses in brackets",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseReverse(test.declaration)
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got: %v", test.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseReverse failed: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		declaration string
+		expected    string
+	}{
+		{declaration: "127.0.0.1:8080:10.244.0.2:80", expected: "127.0.0.1:8080:10.244.0.2:80"},
+		{declaration: "127.0.0.1:53:10.244.0.2:53/udp", expected: "127.0.0.1:53:10.244.0.2:53/udp"},
+		{declaration: "[::1]:8080:[fd00::2]:80/tcp", expected: "[::1]:8080:[fd00::2]:80"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.declaration, func(t *testing.T) {
+			specs, err := Parse(test.declaration, "10.0.0.4")
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+
+			if specs[0].String() != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, specs[0].String())
+			}
+		})
+	}
+
+	reverse, err := ParseReverse("10.244.0.9:80:192.168.1.5:8080")
+	if err != nil {
+		t.Fatalf("ParseReverse failed: %s", err)
+	}
+
+	if reverse[0].String() != "10.244.0.9:80:192.168.1.5:8080" {
+		t.Fatalf("expected the reverse forward to format as it was declared, got %s", reverse[0].String())
+	}
+}
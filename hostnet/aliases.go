@@ -0,0 +1,115 @@
+package hostnet
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+)
+
+// Assigned returns the set of IP addresses
+// assigned to the network interfaces of the host
+func Assigned() (map[string]bool, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect network interfaces: %s", err)
+	}
+
+	assigned := map[string]bool{}
+	for _, addr := range addrs {
+		assigned[strings.Split(addr.String(), "/")[0]] = true
+	}
+
+	return assigned, nil
+}
+
+// AddAliasCommand returns the shell command that assigns
+// the given IP address to the loopback interface
+func AddAliasCommand(ip string) string {
+	if runtime.GOOS == "darwin" {
+		return "ifconfig lo0 alias " + ip
+	}
+
+	return fmt.Sprintf("ip addr add %s/32 dev lo", ip)
+}
+
+// RemoveAliasCommand returns the shell command that removes
+// the given IP address from the loopback interface
+func RemoveAliasCommand(ip string) string {
+	if runtime.GOOS == "darwin" {
+		return "ifconfig lo0 -alias " + ip
+	}
+
+	return fmt.Sprintf("ip addr del %s/32 dev lo", ip)
+}
+
+// Installer describes a system service that
+// assigns loopback aliases on every boot
+type Installer struct {
+	Path     string
+	Contents string
+
+	// Enable and Disable are shell commands that
+	// (de)register the service with the system
+	Enable  string
+	Disable string
+}
+
+const serviceName = "io.github.aemengo.blt.net"
+
+func PersistentInstaller(ips []string) Installer {
+	var commands []string
+	for _, ip := range ips {
+		commands = append(commands, AddAliasCommand(ip))
+	}
+
+	// aliases that already exist must not fail the service
+	script := strings.Join(append(commands, "exit 0"), "; ")
+
+	if runtime.GOOS == "darwin" {
+		file := "/Library/LaunchDaemons/" + serviceName + ".plist"
+
+		return Installer{
+			Path: file,
+			Contents: fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>%s</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>/bin/sh</string>
+    <string>-c</string>
+    <string>%s</string>
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+</dict>
+</plist>
+`, serviceName, script),
+			Enable:  "launchctl load -w " + file,
+			Disable: "launchctl unload -w " + file,
+		}
+	}
+
+	file := "/etc/systemd/system/blt-net.service"
+
+	return Installer{
+		Path: file,
+		Contents: fmt.Sprintf(`[Unit]
+Description=Loopback aliases for BOSH Lit
+After=network.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/sh -c '%s'
+
+[Install]
+WantedBy=multi-user.target
+`, script),
+		Enable:  "systemctl daemon-reload && systemctl enable blt-net.service",
+		Disable: "systemctl disable blt-net.service",
+	}
+}
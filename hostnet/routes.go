@@ -0,0 +1,120 @@
+package hostnet
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+type Route struct {
+	Destination *net.IPNet
+	Interface   string
+}
+
+// Routes returns the IPv4 routes of the host, leaving
+// out default routes and those on loopback interfaces
+func Routes() ([]Route, error) {
+	var command *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		command = exec.Command("netstat", "-rn", "-f", "inet")
+	} else {
+		command = exec.Command("ip", "-4", "route", "show")
+	}
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the routes of your machine: %s", err)
+	}
+
+	var routes []Route
+	for _, line := range strings.Split(string(output), "\n") {
+		route, ok := parseRoute(strings.Fields(line))
+		if !ok || strings.HasPrefix(route.Interface, "lo") {
+			continue
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// Overlapping returns the routes whose destination overlaps the subnet
+func Overlapping(routes []Route, subnet *net.IPNet) []Route {
+	var result []Route
+	for _, r := range routes {
+		if r.Destination.Contains(subnet.IP) || subnet.Contains(r.Destination.IP) {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+func parseRoute(fields []string) (Route, bool) {
+	if len(fields) == 0 || fields[0] == "default" {
+		return Route{}, false
+	}
+
+	if runtime.GOOS != "darwin" {
+		// 10.0.0.0/8 via 10.8.0.1 dev tun0 ...
+		destination, ok := parseDestination(fields[0])
+		if !ok {
+			return Route{}, false
+		}
+
+		route := Route{Destination: destination}
+		for i := 0; i < len(fields)-1; i++ {
+			if fields[i] == "dev" {
+				route.Interface = fields[i+1]
+			}
+		}
+
+		return route, true
+	}
+
+	// Destination Gateway Flags Netif Expire
+	if len(fields) < 4 {
+		return Route{}, false
+	}
+
+	destination, ok := parseDestination(fields[0])
+	if !ok {
+		return Route{}, false
+	}
+
+	return Route{Destination: destination, Interface: fields[3]}, true
+}
+
+// parseDestination understands both regular CIDRs and the
+// abbreviated ones that netstat prints, like 10/8 or 192.168.1
+func parseDestination(s string) (*net.IPNet, bool) {
+	s = strings.Split(s, "%")[0]
+
+	addr, mask := s, ""
+	if i := strings.Index(s, "/"); i >= 0 {
+		addr, mask = s[:i], s[i:]
+	}
+
+	octets := strings.Split(addr, ".")
+	if len(octets) > 4 {
+		return nil, false
+	}
+
+	if mask == "" {
+		mask = fmt.Sprintf("/%d", len(octets)*8)
+	}
+
+	for len(octets) < 4 {
+		octets = append(octets, "0")
+	}
+
+	_, destination, err := net.ParseCIDR(strings.Join(octets, ".") + mask)
+	if err != nil || destination.IP.To4() == nil {
+		return nil, false
+	}
+
+	return destination, true
+}
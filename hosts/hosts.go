@@ -0,0 +1,109 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	beginMarker = "# BEGIN BOSH Lit"
+	endMarker   = "# END BOSH Lit"
+)
+
+type Entry struct {
+	IP    string
+	Names []string
+}
+
+// Render returns the contents of a hosts file with the block managed by
+// blt holding the entries, leaving every line outside of it untouched.
+// Without entries, the block is removed altogether.
+func Render(contents []byte, entries []Entry) ([]byte, error) {
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	var (
+		before, after []string
+		inside, found bool
+	)
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == beginMarker && !found:
+			inside, found = true, true
+		case trimmed == endMarker && inside:
+			inside = false
+		case inside:
+		case found:
+			after = append(after, line)
+		default:
+			before = append(before, line)
+		}
+	}
+
+	if inside {
+		return nil, fmt.Errorf("found '%s' without a matching '%s'", beginMarker, endMarker)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range before {
+		buf.WriteString(line)
+	}
+
+	if len(entries) > 0 {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString(beginMarker + "\n")
+		for _, e := range entries {
+			buf.WriteString(fmt.Sprintf("%s\t%s\n", e.IP, strings.Join(e.Names, " ")))
+		}
+		buf.WriteString(endMarker + "\n")
+	}
+
+	for _, line := range after {
+		buf.WriteString(line)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Write replaces the file with the contents by way of a rename,
+// so that readers never see it half written. A symlink is left
+// in place, with the file that it points to being replaced.
+func Write(file string, contents []byte) error {
+	file, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(file), ".blt-hosts-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	_, err = tmpFile.Write(contents)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpFile.Name(), info.Mode())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), file)
+}
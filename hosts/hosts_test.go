@@ -0,0 +1,173 @@
+package hosts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	entries := []Entry{
+		{IP: "10.0.0.4", Names: []string{"director.blt.local"}},
+		{IP: "10.244.0.34", Names: []string{"router.cf.blt.local", "0.router.cf.blt.local"}},
+	}
+
+	block := "# BEGIN BOSH Lit\n" +
+		"10.0.0.4\tdirector.blt.local\n" +
+		"10.244.0.34\trouter.cf.blt.local 0.router.cf.blt.local\n" +
+		"# END BOSH Lit\n"
+
+	tests := []struct {
+		name     string
+		contents string
+		entries  []Entry
+		expected string
+		err      string
+	}{
+		{
+			name:     "adds the block when there is none",
+			contents: "127.0.0.1\tlocalhost\n",
+			entries:  entries,
+			expected: "127.0.0.1\tlocalhost\n" + block,
+		},
+		{
+			name:     "adds the block to an empty file",
+			contents: "",
+			entries:  entries,
+			expected: block,
+		},
+		{
+			name:     "ends the last line before adding the block",
+			contents: "127.0.0.1\tlocalhost",
+			entries:  entries,
+			expected: "127.0.0.1\tlocalhost\n" + block,
+		},
+		{
+			name:     "replaces an existing block",
+			contents: "127.0.0.1\tlocalhost\n# BEGIN BOSH Lit\n10.0.0.9\told.blt.local\n# END BOSH Lit\n",
+			entries:  entries,
+			expected: "127.0.0.1\tlocalhost\n" + block,
+		},
+		{
+			name:     "preserves the lines around the block",
+			contents: "127.0.0.1\tlocalhost\n\n# BEGIN BOSH Lit\n10.0.0.9\told.blt.local\n# END BOSH Lit\n::1\tlocalhost\n# trailing comment",
+			entries:  entries,
+			expected: "127.0.0.1\tlocalhost\n\n" + block + "::1\tlocalhost\n# trailing comment",
+		},
+		{
+			name:     "removes the block without entries",
+			contents: "127.0.0.1\tlocalhost\n" + block + "::1\tlocalhost\n",
+			expected: "127.0.0.1\tlocalhost\n::1\tlocalhost\n",
+		},
+		{
+			name:     "leaves a file without block alone when there are no entries",
+			contents: "127.0.0.1\tlocalhost\n",
+			expected: "127.0.0.1\tlocalhost\n",
+		},
+		{
+			name:     "fails on a begin marker without end marker",
+			contents: "127.0.0.1\tlocalhost\n# BEGIN BOSH Lit\n10.0.0.4\tdirector.blt.local\n",
+			entries:  entries,
+			err:      "found '# BEGIN BOSH Lit' without a matching '# END BOSH Lit'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Render([]byte(test.contents), test.entries)
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got: %v", test.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Render failed: %s", err)
+			}
+
+			if string(actual) != test.expected {
+				t.Fatalf("expected:\n%q\ngot:\n%q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		symlink bool
+	}{
+		{name: "replaces the file"},
+		{name: "replaces the file that a symlink points to", symlink: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "blt-hosts-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			target := filepath.Join(dir, "hosts")
+			err = ioutil.WriteFile(target, []byte("127.0.0.1\tlocalhost\n"), 0640)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file := target
+			if test.symlink {
+				file = filepath.Join(dir, "link")
+				err = os.Symlink(target, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = Write(file, []byte("::1\tlocalhost\n"))
+			if err != nil {
+				t.Fatalf("Write failed: %s", err)
+			}
+
+			contents, err := ioutil.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(contents) != "::1\tlocalhost\n" {
+				t.Fatalf("expected %s to be replaced, got: %q", target, contents)
+			}
+
+			info, err := os.Stat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode().Perm() != 0640 {
+				t.Fatalf("expected the mode of %s to be kept, got: %o", target, info.Mode().Perm())
+			}
+
+			info, err = os.Lstat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.symlink && info.Mode()&os.ModeSymlink == 0 {
+				t.Fatalf("expected %s to still be a symlink", file)
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected := map[bool]int{false: 1, true: 2}[test.symlink]; len(files) != expected {
+				t.Fatalf("expected no temporary files to be left in %s, found %d files", dir, len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package lit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aemengo/blt/director"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/stemcell"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (e *Environment) AdminPassword() string {
+	output, _ := exec.Command(e.ToolPath("bosh"), "int", path.BoshCredsPath(e.homeDir), "--path", "/admin_password").Output()
+	return strings.TrimSpace(string(output))
+}
+
+// DirectorClient returns a client for the API of the
+// BOSH Lit director, with the credentials of the admin user
+func (e *Environment) DirectorClient() (*director.Client, error) {
+	caCert, err := ioutil.ReadFile(path.BoshCACertPath(e.homeDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the director CA certificate: %s", err)
+	}
+
+	return director.New(e.network.DirectorIP, caCert, "admin", e.AdminPassword())
+}
+
+// BoshCommand returns a bosh CLI invocation that
+// targets the BOSH Lit director
+func (e *Environment) BoshCommand(args ...string) *exec.Cmd {
+	command := exec.Command(e.ToolPath("bosh"), args...)
+	command.Env = os.Environ()
+
+	for _, v := range e.Env() {
+		command.Env = append(command.Env, v.Key+"="+v.Value)
+	}
+
+	return command
+}
+
+// boshCommand is BoshCommand for the runner, with
+// what it prints going to output
+func (e *Environment) boshCommand(output io.Writer, args ...string) Command {
+	command := e.BoshCommand(args...)
+
+	return Command{
+		Path:   command.Path,
+		Args:   command.Args[1:],
+		Env:    command.Env,
+		Stdout: output,
+		Stderr: output,
+	}
+}
+
+// BoshTableRows runs a bosh CLI command with JSON output
+// and returns the rows of the first table it prints
+func (e *Environment) BoshTableRows(args ...string) ([]map[string]string, error) {
+	tables, err := e.BoshTables(args...)
+	if err != nil || len(tables) == 0 {
+		return nil, err
+	}
+
+	return tables[0], nil
+}
+
+// BoshTables runs a bosh CLI command with JSON output
+// and returns the rows of every table it prints
+func (e *Environment) BoshTables(args ...string) ([][]map[string]string, error) {
+	output, err := e.BoshCommand(append(args, "--json")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute 'bosh %s': %s: %s", strings.Join(args, " "), err, output)
+	}
+
+	var result struct {
+		Tables []struct {
+			Rows []map[string]string
+		}
+	}
+
+	err = json.Unmarshal(output, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output of 'bosh %s': %s", strings.Join(args, " "), err)
+	}
+
+	var tables [][]map[string]string
+	for _, t := range result.Tables {
+		tables = append(tables, t.Rows)
+	}
+
+	return tables, nil
+}
+
+// JumpboxCommand returns an ssh invocation that runs
+// the given script on the director as the jumpbox user
+func (e *Environment) JumpboxCommand(script string) *exec.Cmd {
+	return exec.Command("ssh", append(e.JumpboxOptions(), "jumpbox@"+e.network.DirectorIP, script)...)
+}
+
+func (e *Environment) JumpboxOptions() []string {
+	return []string{
+		"-i", path.BoshGWPrivateKeyPath(e.homeDir),
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+	}
+}
+
+// DirectorStemcells returns the uploaded stemcells
+// keyed by both "name/version" and "os/version"
+func (e *Environment) DirectorStemcells() (map[string]bool, error) {
+	rows, err := e.BoshTableRows("stemcells")
+	if err != nil {
+		return nil, err
+	}
+
+	stemcells := map[string]bool{}
+	for _, row := range rows {
+		version := strings.TrimSuffix(row["version"], "*")
+		stemcells[row["name"]+"/"+version] = true
+		stemcells[row["os"]+"/"+version] = true
+	}
+
+	return stemcells, nil
+}
+
+// uploadCachedStemcells uploads every cached stemcell
+// that the director does not already have
+func (e *Environment) uploadCachedStemcells() error {
+	var stemcells []stemcell.Stemcell
+	for _, dir := range e.lookupDirs(path.StemcellCacheDir) {
+		found, err := stemcell.List(dir)
+		if err != nil {
+			return err
+		}
+
+		stemcells = append(stemcells, found...)
+	}
+
+	uploaded, err := e.DirectorStemcells()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stemcells {
+		if uploaded[s.String()] {
+			continue
+		}
+
+		err = s.Verify()
+		if err != nil {
+			return fmt.Errorf("%s, remove it with 'blt stemcell rm %s' and add it again", err, s)
+		}
+
+		var output bytes.Buffer
+
+		err = e.runner.Run(e.boshCommand(&output, "-n", "upload-stemcell", s.Path))
+		if err != nil {
+			return fmt.Errorf("failed to upload stemcell %s: %s: %s", s, err, output.String())
+		}
+
+		// ephemeral environments may find it cached twice
+		uploaded[s.String()] = true
+	}
+
+	return nil
+}
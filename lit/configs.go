@@ -0,0 +1,244 @@
+package lit
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/preset"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ConfigTypes = []string{"cloud", "runtime", "cpi"}
+
+// DirectorConfig is a config declared for the director
+type DirectorConfig struct {
+	Type string
+	Name string
+	Path string
+
+	// OnlyIfMissing marks configs that must not
+	// override what is already on the director
+	OnlyIfMissing bool
+}
+
+func (c DirectorConfig) String() string {
+	return c.Type + "/" + c.Name
+}
+
+// ReconcileConfigs brings every declared config
+// on the director in line with its file
+func (e *Environment) ReconcileConfigs() error {
+	p, err := e.CurrentPreset()
+	if err != nil {
+		return err
+	}
+
+	return e.reconcileConfigs(p)
+}
+
+func (e *Environment) reconcileConfigs(p preset.Preset) error {
+	configs, err := e.desiredConfigs(p)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range configs {
+		action := fmt.Sprintf("update %s config on the director with %s, unless it is the same", c, c.Path)
+		if c.OnlyIfMissing {
+			action = fmt.Sprintf("update %s config on the director with %s, unless it has one", c, c.Path)
+		}
+
+		err := e.runner.Do(action, func() error {
+			_, err := e.ReconcileConfig(c)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReconcileConfig uploads the config when it differs from
+// the director, telling whether it did
+func (e *Environment) ReconcileConfig(c DirectorConfig) (bool, error) {
+	current, ok, err := e.fetchDirectorConfig(c)
+	if err != nil {
+		return false, err
+	}
+
+	if ok && c.OnlyIfMissing {
+		return false, nil
+	}
+
+	desired, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s config at %s: %s", c, c.Path, err)
+	}
+
+	if ok && strings.TrimSpace(current) == strings.TrimSpace(string(desired)) {
+		return false, nil
+	}
+
+	var output bytes.Buffer
+
+	err = e.runner.Run(e.boshCommand(&output, "-n", "update-config", "--type", c.Type, "--name", c.Name, c.Path))
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s config: %s: %s", c, err, output.String())
+	}
+
+	return true, nil
+}
+
+// DiffConfig returns a unified diff from the config on
+// the director to its file, empty when they are the same
+func (e *Environment) DiffConfig(c DirectorConfig) (string, error) {
+	current, ok, err := e.fetchDirectorConfig(c)
+	if err != nil {
+		return "", err
+	}
+
+	if ok && c.OnlyIfMissing {
+		return "", nil
+	}
+
+	tmpFile, err := ioutil.TempFile("", "blt-config-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(current)
+	tmpFile.Close()
+	if err != nil {
+		return "", err
+	}
+
+	output, err := exec.Command("diff", "-u",
+		"--label", "director/"+c.String(),
+		"--label", c.Path,
+		tmpFile.Name(), c.Path).CombinedOutput()
+
+	// diff(1) exits with 1 when the files differ
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s config: %s: %s", c, err, output)
+	}
+
+	return "", nil
+}
+
+// fetchDirectorConfig returns the content of the latest config
+// with the given type and name, and whether it exists at all
+func (e *Environment) fetchDirectorConfig(c DirectorConfig) (string, bool, error) {
+	rows, err := e.BoshTableRows("config", "--type", c.Type, "--name", c.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "No config") {
+			return "", false, nil
+		}
+
+		return "", false, err
+	}
+
+	if len(rows) == 0 {
+		return "", false, nil
+	}
+
+	return rows[0]["content"], true, nil
+}
+
+// DesiredConfigs returns the configs declared under the configs
+// directory, followed by those of the current preset, falling
+// back to the pre-configured cloud-config
+func (e *Environment) DesiredConfigs() ([]DirectorConfig, error) {
+	p, err := e.CurrentPreset()
+	if err != nil {
+		return nil, err
+	}
+
+	return e.desiredConfigs(p)
+}
+
+func (e *Environment) desiredConfigs(p preset.Preset) ([]DirectorConfig, error) {
+	var configs []DirectorConfig
+
+	for _, t := range ConfigTypes {
+		files, err := ioutil.ReadDir(filepath.Join(path.ConfigsDir(e.homeDir), t))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s configs: %s", t, err)
+		}
+
+		for _, f := range files {
+			ext := filepath.Ext(f.Name())
+			if f.IsDir() || (ext != ".yml" && ext != ".yaml") {
+				continue
+			}
+
+			configs = append(configs, DirectorConfig{
+				Type: t,
+				Name: strings.TrimSuffix(f.Name(), ext),
+				Path: filepath.Join(path.ConfigsDir(e.homeDir), t, f.Name()),
+			})
+		}
+	}
+
+	for name, file := range p.RuntimeConfigs {
+		if !hasConfig(configs, "runtime", name) {
+			configs = append(configs, DirectorConfig{Type: "runtime", Name: name, Path: file})
+		}
+	}
+
+	if hasConfig(configs, "cloud", "default") {
+		return configs, nil
+	}
+
+	if p.CloudConfig != "" {
+		return append([]DirectorConfig{{
+			Type: "cloud",
+			Name: "default",
+			Path: p.CloudConfig,
+		}}, configs...), nil
+	}
+
+	cloudConfig := filepath.Join(path.BoshOperationsDir(e.homeDir), "cloud-config.yml")
+
+	// the pre-configured cloud-config only
+	// applies to the default network
+	if !e.network.IsDefault() {
+		cloudConfig = path.GeneratedCloudConfigPath(e.homeDir)
+
+		err := e.runner.WriteFile(cloudConfig, e.network.CloudConfig(), 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write cloud-config for network %s: %s", e.network.CIDR, err)
+		}
+	}
+
+	return append([]DirectorConfig{{
+		Type:          "cloud",
+		Name:          "default",
+		Path:          cloudConfig,
+		OnlyIfMissing: true,
+	}}, configs...), nil
+}
+
+func hasConfig(configs []DirectorConfig, configType string, name string) bool {
+	for _, c := range configs {
+		if c.Type == configType && c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,258 @@
+package lit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/config"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/tools"
+	"github.com/aemengo/blt/versions"
+	"github.com/fatih/color"
+	"os/exec"
+	"strings"
+)
+
+type Dependency struct {
+	Name         string
+	CheckCommand string
+	Site         string
+
+	// Runtime is the only runtime of the VM that
+	// needs the dependency, every one when left out
+	Runtime string
+}
+
+var boldWhite = color.New(color.FgWhite, color.Bold)
+
+func (d Dependency) Usage() string {
+	if d.Site == "" {
+		return boldWhite.Sprint(strings.Title(d.Name))
+	}
+
+	return fmt.Sprintf("%s %s", boldWhite.Sprint(strings.Title(d.Name)), d.Site)
+}
+
+// InspectWith runs the check command of the dependency against the
+// given binary, returning the version it reports or nil when there
+// is none to be found
+func (d Dependency) InspectWith(binary string) (versions.Version, error) {
+	args := strings.Fields(d.CheckCommand)[1:]
+
+	output, err := exec.Command(binary, args...).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := versions.Extract(string(output))
+	return v, nil
+}
+
+var Dependencies = []Dependency{
+	{
+		Name:         "docker",
+		CheckCommand: "docker -v",
+		Site:         "https://store.docker.com/editions/community/docker-ce-desktop-mac",
+		Runtime:      config.RuntimeDocker,
+	},
+	{
+		Name:         "hyperkit",
+		CheckCommand: "hyperkit -v",
+		Site:         "https://github.com/moby/hyperkit",
+		Runtime:      config.RuntimeHyperkit,
+	},
+	{
+		Name:         "bosh",
+		CheckCommand: "bosh -v",
+		Site:         "https://bosh.io/docs/cli-v2",
+	},
+	{
+		Name:         "linuxkit",
+		CheckCommand: "linuxkit version",
+		Site:         "https://github.com/linuxkit/linuxkit",
+	},
+	{
+		Name:         "tar",
+		CheckCommand: "tar --help",
+	},
+}
+
+// PinnableTools are the dependencies that may be
+// pinned under the tools directory of an environment
+var PinnableTools = []string{"bosh", "linuxkit"}
+
+func DependencyNamed(name string) (Dependency, bool) {
+	for _, d := range Dependencies {
+		if d.Name == name {
+			return d, true
+		}
+	}
+
+	return Dependency{}, false
+}
+
+// RequiredDependencies returns the dependencies
+// needed by the runtime of the environment
+func (e *Environment) RequiredDependencies() []Dependency {
+	var result []Dependency
+	for _, d := range Dependencies {
+		if d.Runtime == "" || d.Runtime == e.runtime {
+			result = append(result, d)
+		}
+	}
+
+	return result
+}
+
+// Inspect runs the check command of the dependency
+// against the binary that the environment runs
+func (e *Environment) Inspect(d Dependency) (versions.Version, error) {
+	return d.InspectWith(e.ToolPath(d.Name))
+}
+
+// CheckDependencies makes sure that every required dependency is
+// installed, in a version allowed by the constraints of the assets
+func (e *Environment) CheckDependencies() error {
+	constraints, err := versions.LoadConstraints(path.DependenciesPath(e.homeDir))
+	if err != nil {
+		return err
+	}
+
+	var missingDeps, outdatedDeps []string
+	for _, d := range e.RequiredDependencies() {
+		found, err := e.Inspect(d)
+		if err != nil {
+			missingDeps = append(missingDeps, d.Usage())
+			continue
+		}
+
+		c, ok := constraints[d.Name]
+		if !ok || (found != nil && c.Allows(found)) {
+			continue
+		}
+
+		foundVersion := "an unknown version"
+		if found != nil {
+			foundVersion = found.String()
+		}
+
+		outdatedDeps = append(outdatedDeps, fmt.Sprintf("%s found %s, requires %s", d.Usage(), foundVersion, c))
+	}
+
+	if len(missingDeps) == 0 && len(outdatedDeps) == 0 {
+		return nil
+	}
+
+	var messages []string
+	if len(missingDeps) > 0 {
+		messages = append(messages, "The following dependencies must be installed:")
+		for i, d := range missingDeps {
+			messages = append(messages, fmt.Sprintf("%d: %s", i, d))
+		}
+	}
+
+	if len(outdatedDeps) > 0 {
+		messages = append(messages, "The following dependencies must be changed to a supported version:")
+		for i, d := range outdatedDeps {
+			messages = append(messages, fmt.Sprintf("%d: %s", i, d))
+		}
+	}
+
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// ToolPath returns the binary to run for the named tool,
+// a pinned one when available and the bare name otherwise
+func (e *Environment) ToolPath(name string) string {
+	if p, ok := e.tools[name]; ok {
+		return p
+	}
+
+	e.tools[name] = name
+	if t, ok := e.PinnedTool(name); ok {
+		e.tools[name] = t.Path
+	}
+
+	return e.tools[name]
+}
+
+// PinnedTool returns the highest pinned version of the named
+// tool that the assets allow, if there is any. Ephemeral
+// environments fall back on the tools of the shared home.
+func (e *Environment) PinnedTool(name string) (tools.Tool, bool) {
+	constraints, err := versions.LoadConstraints(path.DependenciesPath(e.homeDir))
+	if err != nil {
+		return tools.Tool{}, false
+	}
+
+	for _, dir := range e.lookupDirs(path.ToolsDir) {
+		installed, err := tools.List(dir)
+		if err != nil {
+			continue
+		}
+
+		if t, ok := tools.Select(installed, name, constraints[name]); ok {
+			return t, true
+		}
+	}
+
+	return tools.Tool{}, false
+}
+
+// InstallTool pins the binary at src as the named tool, in the
+// version it reports, when it matches the expected sha256 checksum
+// if one is given
+func (e *Environment) InstallTool(name string, src string, expectedSHA string) (tools.Tool, error) {
+	d, ok := DependencyNamed(name)
+	if !ok || !contains(PinnableTools, name) {
+		return tools.Tool{}, fmt.Errorf("%s cannot be pinned, only %s can", name, strings.Join(PinnableTools, " and "))
+	}
+
+	// the binary only runs once it is known to be the expected one
+	if expectedSHA != "" {
+		err := tools.VerifySHA256(src, expectedSHA)
+		if err != nil {
+			return tools.Tool{}, err
+		}
+	}
+
+	found, err := d.InspectWith(src)
+	if err != nil {
+		return tools.Tool{}, fmt.Errorf("failed to run %s: %s", src, err)
+	}
+
+	if found == nil {
+		return tools.Tool{}, fmt.Errorf("could not find out the version of %s", src)
+	}
+
+	t, err := tools.Install(path.ToolsDir(e.homeDir), name, found.String(), src, expectedSHA)
+	if err != nil {
+		return tools.Tool{}, err
+	}
+
+	e.tools = map[string]string{}
+	return t, nil
+}
+
+// installBundledTools pins the tools that come with the assets
+func (e *Environment) installBundledTools() error {
+	installed, err := tools.InstallBundled(path.AssetDir(e.homeDir), path.ToolsDir(e.homeDir))
+	if err != nil {
+		return fmt.Errorf("failed to install tools of the assets: %s", err)
+	}
+
+	if len(installed) > 0 {
+		e.tools = map[string]string{}
+	}
+
+	return nil
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package lit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NewEphemeral creates a throwaway environment in a temporary directory,
+// which Remove deletes along with everything in it. The home directory
+// of the environment is the .blt directory within it, so the temporary
+// directory is what BLT_HOME must be set to for the blt CLI to target it.
+//
+// Nothing about the ephemeral environment is written into opts.HomeDir.
+// Its config.yml, presets and configs are copied, while its pinned tools and cached
+// stemcells are looked up in place next to those of the ephemeral one.
+// Its assets are linked to when they are up to date, so that they need
+// not be downloaded again, as they are only ever read.
+func NewEphemeral(opts Options) (*Environment, error) {
+	base := New(opts)
+
+	dir, err := ioutil.TempDir("", "blt-ephemeral-")
+	if err != nil {
+		return nil, err
+	}
+
+	home := filepath.Join(dir, ".blt")
+
+	err = ephemeralHome(base, home)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	opts.HomeDir = home
+	return New(opts), nil
+}
+
+func ephemeralHome(base *Environment, home string) error {
+	err := os.Mkdir(home, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range []string{path.PresetsDir(base.homeDir), path.ConfigsDir(base.homeDir)} {
+		err = copyDir(src, filepath.Join(home, filepath.Base(src)))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into ephemeral environment: %s", src, err)
+		}
+	}
+
+	// later commands that target the ephemeral environment
+	// read their network, dns and runtime from its config
+	if _, err := os.Stat(path.ConfigPath(base.homeDir)); err == nil {
+		err = copyFile(path.ConfigPath(base.homeDir), path.ConfigPath(home))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into ephemeral environment: %s", path.ConfigPath(base.homeDir), err)
+		}
+	}
+
+	if !base.NeedsUpdates() {
+		err = os.Symlink(path.AssetDir(base.homeDir), path.AssetDir(home))
+		if err != nil {
+			return fmt.Errorf("failed to share %s with ephemeral environment: %s", path.AssetDir(base.homeDir), err)
+		}
+	}
+
+	return ioutil.WriteFile(path.EphemeralPath(home), []byte(base.homeDir+"\n"), 0644)
+}
+
+// Ephemeral tells whether the environment was created by NewEphemeral
+func (e *Environment) Ephemeral() bool {
+	_, ok := e.sharedHomeDir()
+	return ok
+}
+
+// sharedHomeDir returns the home directory that an ephemeral
+// environment reads pinned tools and cached stemcells from
+func (e *Environment) sharedHomeDir() (string, bool) {
+	data, err := ioutil.ReadFile(path.EphemeralPath(e.homeDir))
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(data)), true
+}
+
+// lookupDirs returns the directory of the given kind for the
+// environment, followed by the shared one of an ephemeral one
+func (e *Environment) lookupDirs(dir func(string) string) []string {
+	dirs := []string{dir(e.homeDir)}
+	if shared, ok := e.sharedHomeDir(); ok {
+		dirs = append(dirs, dir(shared))
+	}
+
+	return dirs
+}
+
+// Remove brings an ephemeral environment down for good, killing
+// whatever is left of its VM and deleting its home directory
+func (e *Environment) Remove(ctx context.Context) error {
+	if !e.Ephemeral() {
+		return errors.New("only ephemeral environments can be removed")
+	}
+
+	err := e.Down(ctx, DownOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	// the assets are a symlink, which is removed without following it
+	return os.RemoveAll(filepath.Dir(e.homeDir))
+}
+
+// CollectLogs copies the logs of the VM into dir, along with those of
+// the director when it can be reached, returning the files it wrote
+func (e *Environment) CollectLogs(ctx context.Context, dir string) ([]string, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []string{
+		filepath.Join(e.homeDir, "linuxkit.log"),
+		filepath.Join(path.LinuxkitStatePath(e.homeDir), "console-ring"),
+	}
+
+	var collected []string
+	for _, src := range logs {
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+
+		dst := filepath.Join(dir, filepath.Base(src))
+		err = copyFile(src, dst)
+		if err != nil {
+			return collected, fmt.Errorf("failed to collect %s: %s", src, err)
+		}
+
+		collected = append(collected, dst)
+	}
+
+	if _, err := os.Stat(path.BoshGWPrivateKeyPath(e.homeDir)); err != nil {
+		return collected, nil
+	}
+
+	dst := filepath.Join(dir, "director-logs.tgz")
+	err = e.collectDirectorLogs(ctx, dst)
+	if err != nil {
+		os.Remove(dst)
+		return collected, fmt.Errorf("failed to collect the logs of the director: %s", err)
+	}
+
+	return append(collected, dst), nil
+}
+
+// collectDirectorLogs archives the job logs of the director into dst
+func (e *Environment) collectDirectorLogs(ctx context.Context, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var stderr strings.Builder
+
+	command := exec.CommandContext(ctx, "ssh", append(e.JumpboxOptions(),
+		"-o", "ConnectTimeout=10",
+		"jumpbox@"+e.network.DirectorIP,
+		"sudo tar -czf - -C /var/vcap/sys log")...)
+	command.Stdout = out
+	command.Stderr = &stderr
+
+	err = command.Run()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// copyDir copies the files of src into dst, skipping a missing src
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p == src {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+
+		return copyFile(p, target)
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
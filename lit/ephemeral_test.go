@@ -0,0 +1,56 @@
+package lit
+
+import (
+	"github.com/aemengo/blt/config"
+	"github.com/aemengo/blt/path"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewEphemeralKeepsTheConfig(t *testing.T) {
+	home := tempHome(t)
+
+	err := ioutil.WriteFile(path.ConfigPath(home), []byte(`network:
+  director_ip: 10.1.0.4
+  cidr: 10.1.0.0/16
+  gateway: 10.1.0.1
+runtime: hyperkit
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := config.Load(path.ConfigPath(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEphemeral(Options{HomeDir: home, Network: c.Network})
+	if err != nil {
+		t.Fatalf("NewEphemeral failed: %s", err)
+	}
+	defer os.RemoveAll(filepath.Dir(e.HomeDir()))
+
+	if !e.Ephemeral() {
+		t.Fatalf("expected %s to be ephemeral", e.HomeDir())
+	}
+
+	ephemeral, err := config.Load(path.ConfigPath(e.HomeDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ephemeral.Network != c.Network {
+		t.Fatalf("expected the ephemeral environment to resolve network %v, got %v", c.Network, ephemeral.Network)
+	}
+
+	if ephemeral.Runtime != c.Runtime {
+		t.Fatalf("expected the ephemeral environment to resolve runtime %s, got %s", c.Runtime, ephemeral.Runtime)
+	}
+
+	if e.Network() != c.Network {
+		t.Fatalf("expected the ephemeral environment to be on network %v, got %v", c.Network, e.Network())
+	}
+}
@@ -0,0 +1,294 @@
+package lit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/director"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/hostnet"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
+	"strings"
+)
+
+const StepExpose = "Exposing Ports"
+
+// ExposeOptions configures Expose
+type ExposeOptions struct {
+	// Rules to apply and remember, see forward.Rule
+	Rules []forward.Rule
+
+	// Refresh applies every remembered rule again,
+	// resolving the IPs of instances anew
+	Refresh bool
+}
+
+// Expose applies forward rules, remembering them so that
+// they are applied again every time the VM comes up
+func (e *Environment) Expose(ctx context.Context, opts ExposeOptions) error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = e.expectStatus(ctx, vm.VMStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	rules, err := forward.LoadRules(path.ForwardsPath(e.homeDir))
+	if err != nil {
+		return err
+	}
+
+	var pending []forward.Rule
+	if opts.Refresh {
+		pending = append(pending, rules...)
+	}
+
+	for _, rule := range opts.Rules {
+		// what a rule was applied as before is taken down
+		// should it no longer be part of what it resolves to
+		if existing, ok := forward.FindRule(rules, rule); ok {
+			rule.Applied = existing.Applied
+		}
+
+		pending = append(pending, rule)
+	}
+
+	// every rule is resolved before any is applied, so
+	// that an invalid one leaves nothing forwarded
+	var (
+		f        = &forwarder{env: e}
+		resolved = make([][]forward.Spec, len(pending))
+	)
+
+	for i, rule := range pending {
+		resolved[i], err = f.specs(rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, rule := range pending {
+		rule, err = f.apply(ctx, rule, resolved[i])
+		if err != nil {
+			// the rules applied so far stay remembered
+			e.saveRules(rules)
+			return err
+		}
+
+		rules = forward.AddRule(rules, rule)
+	}
+
+	return e.saveRules(rules)
+}
+
+func (e *Environment) saveRules(rules []forward.Rule) error {
+	return e.runner.Do("save the forward rules to "+path.ForwardsPath(e.homeDir), func() error {
+		return forward.SaveRules(path.ForwardsPath(e.homeDir), rules)
+	})
+}
+
+// Forwards returns the forwards in place on the running
+// VM, from the VM to the host followed by the reverse ones
+func (e *Environment) Forwards(ctx context.Context) ([]forward.Spec, error) {
+	err := e.expectStatus(ctx, vm.VMStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := vm.ListForwarded(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed, err := e.reverseForwarded(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(specs, reversed...), nil
+}
+
+// forwarder applies forward rules, resolving the IPs
+// of instances through the director when necessary
+type forwarder struct {
+	env    *Environment
+	client *director.Client
+}
+
+// apply forwards the specs that the rule resolved to, after taking
+// down those it was applied as before that are not among them, like
+// those of a former IP of an instance
+func (f *forwarder) apply(ctx context.Context, rule forward.Rule, specs []forward.Spec) (forward.Rule, error) {
+	applied, err := rule.AppliedSpecs()
+	if err != nil {
+		return rule, err
+	}
+
+	var stale []forward.Spec
+	for _, s := range applied {
+		if !contains(forward.Strings(specs), s.String()) {
+			stale = append(stale, s)
+		}
+	}
+
+	if len(stale) > 0 {
+		if rule.Reverse {
+			err = f.env.reverseUnforward(ctx, stale)
+		} else {
+			err = vm.Unforward(ctx, f.env.homeDir, stale)
+		}
+
+		if err != nil {
+			return rule, fmt.Errorf("failed to take down former forwards of %s: %s", rule, err)
+		}
+	}
+
+	if rule.Reverse {
+		err = f.env.reverseForward(ctx, specs)
+	} else {
+		err = vm.Forward(ctx, specs)
+	}
+
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Applied = forward.Strings(specs)
+	return rule, nil
+}
+
+func (f *forwarder) specs(rule forward.Rule) ([]forward.Spec, error) {
+	if rule.Reverse {
+		return forward.ParseReverse(rule.Declaration)
+	}
+
+	if !rule.IsInstance() {
+		return forward.Parse(rule.Declaration, f.env.network.DirectorIP)
+	}
+
+	if f.client == nil {
+		client, err := f.env.DirectorClient()
+		if err != nil {
+			return nil, err
+		}
+
+		f.client = client
+	}
+
+	vms, err := f.client.VMs(rule.Deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up instances of deployment '%s': %s", rule.Deployment, err)
+	}
+
+	var ips []string
+	for _, v := range vms {
+		if v.Matches(rule.Instance) {
+			ips = append(ips, v.IPs...)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no instance of deployment '%s' with an IP matches '%s'", rule.Deployment, rule.Instance)
+	}
+
+	return rule.InstanceSpecs(ips)
+}
+
+// exposeOnUp forwards the ports of the preset and applies the
+// remembered rules. Rules that can no longer be applied, like those
+// of deleted deployments, are reported without stopping the rest.
+func (e *Environment) exposeOnUp(ctx context.Context, exposed []forward.Spec) error {
+	rules, err := forward.LoadRules(path.ForwardsPath(e.homeDir))
+	if err != nil {
+		return err
+	}
+
+	if len(exposed) == 0 && len(rules) == 0 {
+		return nil
+	}
+
+	e.progress(Progress{Step: StepExpose, State: Started})
+	if len(exposed) > 0 {
+		err = e.runner.Do("forward "+strings.Join(forward.Strings(exposed), ", "), func() error {
+			return vm.Forward(ctx, exposed)
+		})
+		if err != nil {
+			e.progress(Progress{Step: StepExpose, State: Failed})
+			return err
+		}
+	}
+
+	err = e.runner.Do("apply the forward rules of "+path.ForwardsPath(e.homeDir), func() error {
+		exposed, err = e.restoreForwards(ctx, rules, exposed)
+		return err
+	})
+	if err != nil {
+		e.progress(Progress{Step: StepExpose, State: Warned, Message: "Incomplete"})
+		e.progress(Progress{Step: StepExpose, State: Info, Message: err.Error() + "\n"})
+	} else {
+		e.progress(Progress{Step: StepExpose, State: Succeeded})
+	}
+
+	e.warnMissingAddrs(exposed)
+	return nil
+}
+
+// restoreForwards applies the remembered forward rules, appending
+// the specs forwarded to the given ones
+func (e *Environment) restoreForwards(ctx context.Context, rules []forward.Rule, exposed []forward.Spec) ([]forward.Spec, error) {
+	var (
+		f        = &forwarder{env: e}
+		messages []string
+	)
+
+	for i, rule := range rules {
+		specs, err := f.specs(rule)
+		if err == nil {
+			rule, err = f.apply(ctx, rule, specs)
+		}
+
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("failed to expose %s: %s", rule, err))
+			continue
+		}
+
+		rules[i] = rule
+		exposed = append(exposed, specs...)
+	}
+
+	err := e.saveRules(rules)
+	if err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	if len(messages) > 0 {
+		return exposed, errors.New(strings.Join(messages, "\n"))
+	}
+
+	return exposed, nil
+}
+
+// warnMissingAddrs points out host addresses of the given
+// forwards that are not yet assigned to a network interface
+func (e *Environment) warnMissingAddrs(forwards []forward.Spec) {
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		return
+	}
+
+	for _, f := range forwards {
+		if !assigned[f.HostIP] {
+			e.progress(Progress{
+				Step:    StepExpose,
+				State:   Noted,
+				Message: `some exposed addresses are not yet routable from your machine, to fix that run "blt net setup"`,
+			})
+			return
+		}
+	}
+}
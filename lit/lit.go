@@ -0,0 +1,334 @@
+// Package lit drives a BOSH Lit environment, as the blt CLI does,
+// for programs like integration tests that need one of their own.
+package lit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/config"
+	"github.com/aemengo/blt/lock"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Options configures an Environment, where only HomeDir is required
+type Options struct {
+	// HomeDir holds the assets and state of the
+	// environment, which is $HOME/.blt for the CLI
+	HomeDir string
+
+	// Version of the assets to download, which
+	// are never downloaded for the DEV version
+	Version string
+
+	// Network of the environment, config.DefaultNetwork when left out
+	Network config.Network
+
+	// Runtime of the VM, config.DefaultRuntime when left out
+	Runtime string
+
+	// Wait for other processes changing the
+	// environment to finish, rather than failing
+	Wait bool
+
+	// Output receives what long running commands
+	// like bosh create-env print, if anything
+	Output io.Writer
+
+	// Progress receives the steps of operations as they go
+	Progress func(Progress)
+
+	// Runner carries out the commands and file changes
+	// of operations, an ExecRunner when left out
+	Runner Runner
+}
+
+// State of a step reported through Options.Progress
+type State int
+
+const (
+	// Started comes first for every step
+	Started State = iota
+
+	// Succeeded, Warned and Failed finish a step, where
+	// the message of Warned tells how it fell short
+	Succeeded
+	Warned
+	Failed
+
+	// Info carries raw output of a step, like download progress
+	Info
+
+	// Noted carries advice that comes along with a step
+	Noted
+)
+
+type Progress struct {
+	Step    string
+	State   State
+	Message string
+}
+
+var ErrRunning = errors.New("BOSH Lit is already running")
+
+// StatusError is returned when the VM does not have the
+// status required by an operation, which is the Required one
+type StatusError struct {
+	Required vm.Status
+	Current  vm.Status
+}
+
+func (e *StatusError) Error() string {
+	if e.Required == vm.VMStatusStopped {
+		return fmt.Sprintf("your VM must be stopped before you can perform this action, it is currently: %s", e.Current)
+	}
+
+	return fmt.Sprintf("your VM must be running before you can perform this action, it is currently: %s", e.Current)
+}
+
+// Environment is a BOSH Lit environment, made of
+// a VM and a BOSH director deployed onto it
+type Environment struct {
+	homeDir  string
+	version  string
+	network  config.Network
+	runtime  string
+	wait     bool
+	output   io.Writer
+	progress func(Progress)
+	runner   Runner
+
+	// tools caches the binary to run per dependency name
+	tools map[string]string
+}
+
+func New(opts Options) *Environment {
+	e := &Environment{
+		homeDir:  opts.HomeDir,
+		version:  opts.Version,
+		network:  opts.Network,
+		runtime:  opts.Runtime,
+		wait:     opts.Wait,
+		output:   opts.Output,
+		progress: opts.Progress,
+		runner:   opts.Runner,
+		tools:    map[string]string{},
+	}
+
+	if e.version == "" {
+		e.version = "DEV"
+	}
+
+	if e.network.DirectorIP == "" {
+		e.network = config.DefaultNetwork
+	}
+
+	if e.runtime == "" {
+		e.runtime = config.DefaultRuntime
+	}
+
+	if e.output == nil {
+		e.output = ioutil.Discard
+	}
+
+	if e.progress == nil {
+		e.progress = func(Progress) {}
+	}
+
+	if e.runner == nil {
+		e.runner = ExecRunner{}
+	}
+
+	return e
+}
+
+func (e *Environment) HomeDir() string {
+	return e.homeDir
+}
+
+func (e *Environment) Network() config.Network {
+	return e.network
+}
+
+// Status returns the status of the VM, along
+// with the reason when it is unresponsive
+func (e *Environment) Status(ctx context.Context) (vm.Status, error) {
+	err := vm.Check(ctx, e.homeDir)
+	switch vm.Cause(err) {
+	case nil:
+		return vm.VMStatusRunning, nil
+	case vm.ErrVMStopped:
+		return vm.VMStatusStopped, nil
+	default:
+		return vm.VMStatusUnresponsive, err
+	}
+}
+
+// Variable is an environment variable for targeting the director
+type Variable struct {
+	Key   string
+	Value string
+}
+
+// Env returns the variables that the bosh CLI needs to
+// target the director, as printed by "blt env"
+func (e *Environment) Env() []Variable {
+	return []Variable{
+		{"BOSH_ENVIRONMENT", e.network.DirectorIP},
+		{"BOSH_CLIENT", "admin"},
+		{"BOSH_CLIENT_SECRET", e.AdminPassword()},
+		{"BOSH_CA_CERT", path.BoshCACertPath(e.homeDir)},
+		{"BOSH_GW_HOST", e.network.DirectorIP},
+		{"BOSH_GW_USER", "jumpbox"},
+		{"BOSH_GW_PRIVATE_KEY", path.BoshGWPrivateKeyPath(e.homeDir)},
+	}
+}
+
+// DownOptions configures Down
+type DownOptions struct {
+	// Force kills any hypervisor processes left behind for the VM,
+	// even without a pid file, and goes ahead even when another
+	// process holds the lock, as it may be hung
+	Force bool
+}
+
+func (e *Environment) Down(ctx context.Context, opts DownOptions) error {
+	acquire := e.lock
+	if opts.Force {
+		acquire = e.lockUnlessHeld
+	}
+
+	unlock, err := acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// forwards from the host go along with the VM
+	err = e.runner.Do("close the connection that forwards from the host", func() error {
+		return e.stopReverseMaster(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = e.runner.Do("stop the VM", func() error {
+		vm.Stop(ctx, e.homeDir)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// an Up brought down midway starts over the next time
+	err = e.runner.Remove(path.UpProgressPath(e.homeDir))
+	if err != nil {
+		return err
+	}
+
+	if !opts.Force {
+		return nil
+	}
+
+	return e.runner.Do("kill any hypervisor processes left behind for the VM", func() error {
+		killed, err := vm.KillOrphans(e.homeDir)
+		for _, pid := range killed {
+			e.progress(Progress{Step: "Stopping VM", State: Info, Message: fmt.Sprintf("Killed orphaned process %d\n", pid)})
+		}
+
+		return err
+	})
+}
+
+// Prune reclaims the disk space of unused blocks in the VM
+func (e *Environment) Prune(ctx context.Context) error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = e.expectStatus(ctx, vm.VMStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	return vm.Prune(ctx)
+}
+
+// Destroy removes the state of the environment,
+// which requires the VM to be stopped
+func (e *Environment) Destroy(ctx context.Context) error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = e.expectStatus(ctx, vm.VMStatusStopped)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(path.StateDir(e.homeDir))
+}
+
+func (e *Environment) expectStatus(ctx context.Context, required vm.Status) error {
+	status := vm.GetStatus(ctx, e.homeDir)
+	if status != required {
+		return &StatusError{Required: required, Current: status}
+	}
+
+	return nil
+}
+
+// Lock keeps other processes from changing the environment
+// until the returned function is called, or the process exits
+func (e *Environment) Lock() (func(), error) {
+	return e.lock()
+}
+
+// lockUnlessHeld takes the lock when it is free, and
+// otherwise goes on without it after noting who holds it
+func (e *Environment) lockUnlessHeld() (func(), error) {
+	l, err := lock.Acquire(path.LockPath(e.homeDir), false)
+
+	if held, ok := err.(*lock.HeldError); ok {
+		e.progress(Progress{State: Noted, Message: fmt.Sprintf("going ahead even though your environment is being changed by %s", held.Holder)})
+		return func() {}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { l.Release() }, nil
+}
+
+func (e *Environment) lock() (func(), error) {
+	// dry runs change nothing that needs guarding
+	if _, ok := e.runner.(DryRunner); ok {
+		return func() {}, nil
+	}
+
+	l, err := lock.Acquire(path.LockPath(e.homeDir), false)
+
+	if held, ok := err.(*lock.HeldError); ok {
+		if !e.wait {
+			return nil, fmt.Errorf("your environment is being changed by %s, try again once it is done or pass --wait", held.Holder)
+		}
+
+		e.progress(Progress{State: Info, Message: fmt.Sprintf("Waiting for %s to finish...\n", held.Holder)})
+		l, err = lock.Acquire(path.LockPath(e.homeDir), true)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { l.Release() }, nil
+}
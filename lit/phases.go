@@ -0,0 +1,146 @@
+package lit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vm"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Phases of Up, in the order they run
+const (
+	PhaseValidate  = "validate"
+	PhaseAssets    = "assets"
+	PhaseBoot      = "boot"
+	PhaseWait      = "wait"
+	PhaseDeploy    = "deploy-director"
+	PhaseConfigure = "configure"
+	PhasePostUp    = "post-up"
+)
+
+var Phases = []string{
+	PhaseValidate,
+	PhaseAssets,
+	PhaseBoot,
+	PhaseWait,
+	PhaseDeploy,
+	PhaseConfigure,
+	PhasePostUp,
+}
+
+// upProgress is what an Up that has yet to
+// complete persists about the phases it got through
+type upProgress struct {
+	Preset    string   `json:"preset"`
+	Completed []string `json:"completed"`
+}
+
+// next returns the index of the first phase
+// in Phases that has yet to complete
+func (p upProgress) next() int {
+	for i, phase := range Phases {
+		if !contains(p.Completed, phase) {
+			return i
+		}
+	}
+
+	return len(Phases)
+}
+
+// firstPhase returns the index of the phase in Phases for Up to start
+// at, given the phase asked for and the progress of the last Up
+func (e *Environment) firstPhase(ctx context.Context, opts UpOptions) (int, error) {
+	status := vm.GetStatus(ctx, e.homeDir)
+	boot := phaseIndex(PhaseBoot)
+
+	if opts.From != "" {
+		i := phaseIndex(opts.From)
+		if i < 0 {
+			return 0, unknownPhaseError(opts.From)
+		}
+
+		if i <= boot && status != vm.VMStatusStopped {
+			return 0, &StatusError{Required: vm.VMStatusStopped, Current: status}
+		}
+
+		if i > boot && status == vm.VMStatusStopped {
+			return 0, &StatusError{Required: vm.VMStatusRunning, Current: status}
+		}
+
+		return i, nil
+	}
+
+	progress, err := e.loadUpProgress()
+	if err != nil {
+		return 0, err
+	}
+
+	i := progress.next()
+
+	// the VM has since been brought down, so whatever got
+	// through the phases after booting it has to be done again
+	if i > boot && status == vm.VMStatusStopped {
+		i = 0
+	}
+
+	if i == 0 || i == len(Phases) || (i <= boot && status != vm.VMStatusStopped) {
+		if status != vm.VMStatusStopped {
+			return 0, ErrRunning
+		}
+
+		return 0, nil
+	}
+
+	if opts.Preset != "" && opts.Preset != progress.Preset {
+		return 0, fmt.Errorf("the last 'blt up' of preset '%s' failed in the %s phase, run it again without a preset to resume or run 'blt down' to start over", progress.Preset, Phases[i])
+	}
+
+	return i, nil
+}
+
+func (e *Environment) loadUpProgress() (upProgress, error) {
+	var progress upProgress
+
+	data, err := ioutil.ReadFile(path.UpProgressPath(e.homeDir))
+	if os.IsNotExist(err) {
+		return progress, nil
+	}
+
+	if err != nil {
+		return progress, fmt.Errorf("failed to read the progress of the last 'blt up': %s", err)
+	}
+
+	err = json.Unmarshal(data, &progress)
+	if err != nil {
+		return progress, fmt.Errorf("failed to parse the progress of the last 'blt up' at %s: %s", path.UpProgressPath(e.homeDir), err)
+	}
+
+	return progress, nil
+}
+
+func (e *Environment) saveUpProgress(progress upProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	return e.runner.WriteFile(path.UpProgressPath(e.homeDir), data, 0644)
+}
+
+func phaseIndex(phase string) int {
+	for i, p := range Phases {
+		if p == phase {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unknownPhaseError(phase string) error {
+	return fmt.Errorf("unknown phase '%s', must be one of: %s", phase, strings.Join(Phases, ", "))
+}
@@ -0,0 +1,38 @@
+package lit
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/preset"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func (e *Environment) CurrentPresetName() (string, error) {
+	data, err := ioutil.ReadFile(path.PresetPath(e.homeDir))
+	if os.IsNotExist(err) {
+		return preset.Default, nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read the selected preset: %s", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// CurrentPreset returns the preset that the
+// environment was last brought up with
+func (e *Environment) CurrentPreset() (preset.Preset, error) {
+	name, err := e.CurrentPresetName()
+	if err != nil {
+		return preset.Preset{}, err
+	}
+
+	return preset.Load(name, path.PresetsDir(e.homeDir), path.AssetDir(e.homeDir))
+}
+
+func (e *Environment) saveCurrentPreset(name string) error {
+	return e.runner.WriteFile(path.PresetPath(e.homeDir), []byte(name+"\n"), 0644)
+}
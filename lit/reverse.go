@@ -0,0 +1,241 @@
+package lit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/path"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Reverse forwards go through the jumpbox of the director, which is on
+// the VM network. They are remote forwards of a master ssh connection,
+// bound to container IPs that the director takes on, so that they are
+// gone along with the connection once the VM stops.
+//
+// sshd is told to allow them in its config for as long as the master
+// connection is open, under a marker that tells the line apart from
+// one that was there before, which is then left alone.
+
+const gatewayPortsMarker = "# added by blt for reverse forwards"
+
+// reverseForward makes the host addresses of the specs
+// reachable on their IPs of the VM network
+func (e *Environment) reverseForward(ctx context.Context, specs []forward.Spec) error {
+	for _, s := range specs {
+		if s.Protocol != forward.TCP {
+			return fmt.Errorf("cannot forward %s from the host, only TCP can go through the jumpbox", s)
+		}
+	}
+
+	err := e.startReverseMaster(ctx)
+	if err != nil {
+		return err
+	}
+
+	forwarded, err := e.loadReverseForwards()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range specs {
+		if contains(forwarded, s.String()) {
+			continue
+		}
+
+		output, err := exec.CommandContext(ctx, "ssh", append(e.JumpboxOptions(), "jumpbox@"+e.network.DirectorIP, e.assignAddrScript(s.ContainerIP))...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to assign %s to the director: %s: %s", s.ContainerIP, err, output)
+		}
+
+		output, err = e.reverseControl(ctx, "-O", "forward", "-R", s.String()).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to forward %s from the host: %s: %s", s, err, output)
+		}
+
+		forwarded = append(forwarded, s.String())
+	}
+
+	return e.saveReverseForwards(forwarded)
+}
+
+// reverseUnforward takes down the reverse forwards of
+// the specs, skipping those that are not in place
+func (e *Environment) reverseUnforward(ctx context.Context, specs []forward.Spec) error {
+	current, err := e.reverseForwarded(ctx)
+	if err != nil {
+		return err
+	}
+
+	forwarded := forward.Strings(current)
+
+	var remaining []string
+	for _, s := range forwarded {
+		if !contains(forward.Strings(specs), s) {
+			remaining = append(remaining, s)
+			continue
+		}
+
+		output, err := e.reverseControl(ctx, "-O", "cancel", "-R", s).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to stop forwarding %s from the host: %s: %s", s, err, output)
+		}
+	}
+
+	if len(remaining) == len(forwarded) {
+		return nil
+	}
+
+	if len(remaining) == 0 {
+		return e.stopReverseMaster(ctx)
+	}
+
+	return e.saveReverseForwards(remaining)
+}
+
+// reverseForwarded returns the reverse forwards in place
+func (e *Environment) reverseForwarded(ctx context.Context) ([]forward.Spec, error) {
+	if !e.reverseMasterAlive(ctx) {
+		return nil, nil
+	}
+
+	forwarded, err := e.loadReverseForwards()
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []forward.Spec
+	for _, s := range forwarded {
+		parsed, err := forward.ParseReverse(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the forwards from the host: %s", err)
+		}
+
+		specs = append(specs, parsed...)
+	}
+
+	return specs, nil
+}
+
+func (e *Environment) startReverseMaster(ctx context.Context) error {
+	if e.reverseMasterAlive(ctx) {
+		return nil
+	}
+
+	// sshd only binds remote forwards to addresses other than loopback
+	// when told so, which applies to connections made afterwards
+	script := fmt.Sprintf(`grep -q '^GatewayPorts clientspecified' /etc/ssh/sshd_config ||
+{ sudo sed -i -e '1i %[1]s' -e '1i GatewayPorts clientspecified' /etc/ssh/sshd_config && sudo kill -HUP "$(cat /var/run/sshd.pid)"; }`,
+		gatewayPortsMarker)
+
+	output, err := exec.CommandContext(ctx, "ssh", append(e.JumpboxOptions(), "jumpbox@"+e.network.DirectorIP, script)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to allow forwards from the host on the jumpbox: %s: %s", err, output)
+	}
+
+	// the master goes into the background and holds on to what it is
+	// given as output, which is why none is given to it
+	err = e.reverseControl(ctx,
+		"-M", "-f", "-N",
+		"-o", "ControlPersist=yes",
+		"-o", "ServerAliveInterval=10",
+		"-o", "ExitOnForwardFailure=yes").Run()
+	if err != nil {
+		e.restoreGatewayPorts(ctx)
+		return fmt.Errorf("failed to connect to the jumpbox: %s", err)
+	}
+
+	// a new master carries no forwards yet
+	return e.saveReverseForwards(nil)
+}
+
+// stopReverseMaster takes down the master connection along with every
+// reverse forward that it carries, and the config that allowed them
+func (e *Environment) stopReverseMaster(ctx context.Context) error {
+	if e.reverseMasterAlive(ctx) {
+		e.reverseControl(ctx, "-O", "exit").Run()
+
+		err := e.restoreGatewayPorts(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(path.ReverseForwardsPath(e.homeDir))
+}
+
+// restoreGatewayPorts takes out what startReverseMaster added
+// to the config of sshd, if anything, which applies to the
+// connections made afterwards
+func (e *Environment) restoreGatewayPorts(ctx context.Context) error {
+	script := fmt.Sprintf(`if grep -qx '%[1]s' /etc/ssh/sshd_config; then
+sudo sed -i '/^%[1]s$/,+1d' /etc/ssh/sshd_config && sudo kill -HUP "$(cat /var/run/sshd.pid)"; fi`,
+		gatewayPortsMarker)
+
+	output, err := exec.CommandContext(ctx, "ssh", append(e.JumpboxOptions(), "jumpbox@"+e.network.DirectorIP, script)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restore the config of sshd on the jumpbox: %s: %s", err, output)
+	}
+
+	return nil
+}
+
+func (e *Environment) reverseMasterAlive(ctx context.Context) bool {
+	if _, err := os.Stat(path.ReverseControlPath(e.homeDir)); err != nil {
+		return false
+	}
+
+	return e.reverseControl(ctx, "-O", "check").Run() == nil
+}
+
+// reverseControl returns an ssh invocation that goes
+// through the master connection of reverse forwards
+func (e *Environment) reverseControl(ctx context.Context, args ...string) *exec.Cmd {
+	args = append(append(e.JumpboxOptions(), "-o", "ControlPath="+path.ReverseControlPath(e.homeDir)), args...)
+	return exec.CommandContext(ctx, "ssh", append(args, "jumpbox@"+e.network.DirectorIP)...)
+}
+
+// assignAddrScript assigns the IP to the interface of
+// the director on the VM network, unless it has it
+func (e *Environment) assignAddrScript(ip string) string {
+	bits := "32"
+	if strings.Contains(ip, ":") {
+		bits = "128"
+	}
+
+	return fmt.Sprintf(`ip -o addr show | grep -q ' %[1]s/' ||
+sudo ip addr add %[1]s/%[2]s dev "$(ip -o addr show | awk -v ip=%[3]s 'index($4, ip "/") == 1 {print $2}')"`,
+		ip, bits, e.network.DirectorIP)
+}
+
+func (e *Environment) loadReverseForwards() ([]string, error) {
+	data, err := ioutil.ReadFile(path.ReverseForwardsPath(e.homeDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var forwarded []string
+	err = json.Unmarshal(data, &forwarded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path.ReverseForwardsPath(e.homeDir), err)
+	}
+
+	return forwarded, nil
+}
+
+func (e *Environment) saveReverseForwards(forwarded []string) error {
+	data, err := json.Marshal(forwarded)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.ReverseForwardsPath(e.homeDir), data, 0644)
+}
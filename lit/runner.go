@@ -0,0 +1,238 @@
+package lit
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Runner carries out what operations of an Environment do to the
+// machine, like running commands and writing files. ExecRunner does so
+// for real, DryRunner prints it instead and FakeRunner records it.
+//
+// Reading state, like the status of the VM or the version of a
+// dependency, never goes through the Runner.
+type Runner interface {
+	// Run runs the command to completion
+	Run(c Command) error
+
+	// Start starts the command without waiting for it
+	Start(c Command) error
+
+	// WriteFile writes data to the file, creating
+	// the directory that holds it when missing
+	WriteFile(name string, data []byte, perm os.FileMode) error
+
+	// Remove removes the file or directory along with its contents
+	Remove(name string) error
+
+	// Do carries out anything else, where action says what fn does
+	Do(action string, fn func() error) error
+}
+
+// Command is a command for a Runner to run
+type Command struct {
+	Path string
+	Args []string
+
+	// Env of the command, that of this process when nil
+	Env []string
+
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// LogFile receives the output of the command
+	// in place of Stdout and Stderr when set
+	LogFile string
+}
+
+func (c Command) String() string {
+	var words = []string{quote(c.Path)}
+	for _, arg := range c.Args {
+		words = append(words, quote(arg))
+	}
+
+	if c.LogFile != "" {
+		words = append(words, ">", quote(c.LogFile), "2>&1")
+	}
+
+	return strings.Join(words, " ")
+}
+
+func quote(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t\n'\"\\$&;|<>*?()`") {
+		return word
+	}
+
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// ExecRunner is the Runner that carries everything out
+type ExecRunner struct{}
+
+func (ExecRunner) Run(c Command) error {
+	command, logFile, err := c.exec()
+	if err != nil {
+		return err
+	}
+
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	return command.Run()
+}
+
+func (ExecRunner) Start(c Command) error {
+	command, logFile, err := c.exec()
+	if err != nil {
+		return err
+	}
+
+	// the command holds on to the file of its own
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	return command.Start()
+}
+
+func (ExecRunner) WriteFile(name string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(name), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (ExecRunner) Remove(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (ExecRunner) Do(action string, fn func() error) error {
+	return fn()
+}
+
+func (c Command) exec() (*exec.Cmd, *os.File, error) {
+	command := exec.Command(c.Path, c.Args...)
+	command.Env = c.Env
+	command.Stdout = c.Stdout
+	command.Stderr = c.Stderr
+
+	if c.LogFile == "" {
+		return command, nil, nil
+	}
+
+	logFile, err := os.Create(c.LogFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	command.Stdout = logFile
+	command.Stderr = logFile
+	return command, logFile, nil
+}
+
+// DryRunner is the Runner that prints what it would
+// carry out to Output, one line at a time
+type DryRunner struct {
+	Output io.Writer
+}
+
+func (r DryRunner) Run(c Command) error {
+	return r.print(c.String())
+}
+
+func (r DryRunner) Start(c Command) error {
+	return r.print(c.String() + " &")
+}
+
+func (r DryRunner) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return r.print(fmt.Sprintf("write %s (%d bytes, mode %04o)", name, len(data), perm))
+}
+
+func (r DryRunner) Remove(name string) error {
+	return r.print("rm -rf " + quote(name))
+}
+
+func (r DryRunner) Do(action string, fn func() error) error {
+	return r.print(action)
+}
+
+func (r DryRunner) print(line string) error {
+	_, err := fmt.Fprintf(r.Output, "  %s\n", line)
+	return err
+}
+
+// FakeRunner is the Runner that records what it would carry out, in
+// the same words as DryRunner, for tests of programs built on lit
+type FakeRunner struct {
+	// Steps that were carried out, in order
+	Steps []string
+
+	// Errors fails the steps that begin with the keys
+	Errors map[string]error
+
+	// Outputs are written to the stdout of the commands, the
+	// first one whose prefix a command begins with applying
+	Outputs []FakeOutput
+}
+
+// FakeOutput is the output of the commands
+// that begin with Prefix, for a FakeRunner
+type FakeOutput struct {
+	Prefix string
+	Stdout string
+}
+
+func (r *FakeRunner) Run(c Command) error {
+	err := r.record(c.String())
+	if err != nil {
+		return err
+	}
+
+	for _, o := range r.Outputs {
+		if strings.HasPrefix(c.String(), o.Prefix) {
+			if c.Stdout != nil {
+				io.WriteString(c.Stdout, o.Stdout)
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *FakeRunner) Start(c Command) error {
+	return r.record(c.String() + " &")
+}
+
+func (r *FakeRunner) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return r.record(fmt.Sprintf("write %s (%d bytes, mode %04o)", name, len(data), perm))
+}
+
+func (r *FakeRunner) Remove(name string) error {
+	return r.record("rm -rf " + quote(name))
+}
+
+func (r *FakeRunner) Do(action string, fn func() error) error {
+	return r.record(action)
+}
+
+func (r *FakeRunner) record(step string) error {
+	r.Steps = append(r.Steps, step)
+
+	for prefix, err := range r.Errors {
+		if strings.HasPrefix(step, prefix) {
+			return err
+		}
+	}
+
+	return nil
+}
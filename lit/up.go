@@ -0,0 +1,477 @@
+package lit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aemengo/blt/backup"
+	"github.com/aemengo/blt/forward"
+	"github.com/aemengo/blt/hostnet"
+	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/preset"
+	"github.com/aemengo/blt/vm"
+	"github.com/aemengo/blt/web"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Steps of Up, as reported through Options.Progress
+const (
+	StepValidate  = "Validating Prerequisites"
+	StepAssets    = "Checking Assets"
+	StepBoot      = "Starting VM"
+	StepWait      = "Waiting for VM"
+	StepDeploy    = "Deploying Director"
+	StepConfigure = "Configuring Director"
+	StepStemcells = "Uploading Stemcells"
+)
+
+// Resources of the VM when neither the options of Up nor the preset set them
+const (
+	DefaultCPU    = "4"
+	DefaultMemory = "4096"
+	DefaultDisk   = "40"
+)
+
+// UpOptions configures Up
+type UpOptions struct {
+	// Preset to bring the VM up with, see "blt presets",
+	// which is the one last used when left out
+	Preset string
+
+	// CPU, Memory in megabytes and Disk in gigabytes of the VM,
+	// those of the preset or the defaults when left out
+	CPU    string
+	Memory string
+	Disk   string
+
+	// UploadStemcells uploads stemcells of the
+	// cache that the director is missing
+	UploadStemcells bool
+
+	// From is the phase to start at, see Phases, rather than the
+	// first one or the one that the last Up failed in. Phases up to
+	// PhaseBoot require the VM to be stopped, later ones that it is not.
+	From string
+}
+
+// Up boots the VM and deploys the director onto it in phases, see
+// Phases. An Up that failed is resumed at the phase it failed in, as
+// long as the VM was not brought down since. Otherwise it fails with
+// ErrRunning when the VM is not stopped.
+func (e *Environment) Up(ctx context.Context, opts UpOptions) error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	start, err := e.firstPhase(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	r := &upRun{opts: opts}
+
+	// the phases skipped have validated the current preset already
+	if start > 0 {
+		e.progress(Progress{State: Info, Message: fmt.Sprintf("Resuming from the %s phase\n", Phases[start])})
+
+		err = e.loadPreset(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := start; i < len(Phases); i++ {
+		err = e.runPhase(ctx, Phases[i], r)
+		if err != nil {
+			return err
+		}
+
+		err = e.saveUpProgress(upProgress{Preset: r.preset.Name, Completed: Phases[:i+1]})
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.runner.Remove(path.UpProgressPath(e.homeDir))
+}
+
+// upRun carries what the phases of an Up share
+type upRun struct {
+	opts    UpOptions
+	preset  preset.Preset
+	exposed []forward.Spec
+}
+
+func (e *Environment) runPhase(ctx context.Context, phase string, r *upRun) error {
+	switch phase {
+	case PhaseValidate:
+		return e.step(StepValidate, func() error {
+			return e.validate(r)
+		})
+	case PhaseAssets:
+		return e.updateAssets()
+	case PhaseBoot:
+		return e.step(StepBoot, func() error {
+			return e.boot(
+				firstOf(r.opts.CPU, r.preset.CPU, DefaultCPU),
+				firstOf(r.opts.Memory, r.preset.Memory, DefaultMemory),
+				firstOf(r.opts.Disk, r.preset.Disk, DefaultDisk))
+		})
+	case PhaseWait:
+		return e.step(StepWait, func() error {
+			return e.runner.Do(fmt.Sprintf("wait up to %s for the VM to be running", time.Minute), func() error {
+				return vm.WaitForStatus(ctx, vm.VMStatusRunning, e.homeDir, time.Minute)
+			})
+		})
+	case PhaseDeploy:
+		return e.step(StepDeploy, func() error {
+			return e.deployDirector(r.preset)
+		})
+	case PhaseConfigure:
+		return e.step(StepConfigure, func() error {
+			return e.configureDirector(r.preset)
+		})
+	case PhasePostUp:
+		if r.opts.UploadStemcells {
+			err := e.step(StepStemcells, func() error {
+				return e.runner.Do("upload the stemcells of "+path.StemcellCacheDir(e.homeDir)+" that the director is missing", e.uploadCachedStemcells)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return e.exposeOnUp(ctx, r.exposed)
+	default:
+		return unknownPhaseError(phase)
+	}
+}
+
+func (e *Environment) validate(r *upRun) error {
+	err := e.CheckDependencies()
+	if err != nil {
+		return err
+	}
+
+	r.preset, err = e.selectPreset(r.opts.Preset)
+	if err != nil {
+		return err
+	}
+
+	r.exposed, err = forward.ParseAll(r.preset.Expose, e.network.DirectorIP)
+	if err != nil {
+		return fmt.Errorf("preset '%s' is invalid: %s", r.preset.Name, err)
+	}
+
+	err = e.checkNetworkRoutes()
+	if err != nil {
+		return err
+	}
+
+	return e.checkNetworkAddrs()
+}
+
+// loadPreset loads the preset that the validate
+// phase selected, for the phases after it
+func (e *Environment) loadPreset(r *upRun) error {
+	p, err := e.CurrentPreset()
+	if err != nil {
+		return err
+	}
+
+	r.preset = p
+	r.exposed, err = forward.ParseAll(p.Expose, e.network.DirectorIP)
+	if err != nil {
+		return fmt.Errorf("preset '%s' is invalid: %s", p.Name, err)
+	}
+
+	return nil
+}
+
+// step reports the given step around running it
+func (e *Environment) step(name string, fn func() error) error {
+	e.progress(Progress{Step: name, State: Started})
+
+	err := fn()
+	if err != nil {
+		e.progress(Progress{Step: name, State: Failed})
+		return err
+	}
+
+	e.progress(Progress{Step: name, State: Succeeded})
+	return nil
+}
+
+// selectPreset loads the requested preset, or the one last used,
+// and remembers it as the one last used
+func (e *Environment) selectPreset(name string) (preset.Preset, error) {
+	var (
+		p   preset.Preset
+		err error
+	)
+
+	if name == "" {
+		p, err = e.CurrentPreset()
+	} else {
+		p, err = preset.Load(name, path.PresetsDir(e.homeDir), path.AssetDir(e.homeDir))
+	}
+
+	if err != nil {
+		return preset.Preset{}, err
+	}
+
+	return p, e.saveCurrentPreset(p.Name)
+}
+
+// NeedsUpdates tells whether the assets must be downloaded
+// for the version of the environment
+func (e *Environment) NeedsUpdates() bool {
+	if e.version == "DEV" {
+		return false
+	}
+
+	contents, err := ioutil.ReadFile(path.AssetVersionPath(e.homeDir))
+	if err != nil {
+		return true
+	}
+
+	return strings.TrimSpace(string(contents)) != e.version
+}
+
+func (e *Environment) updateAssets() error {
+	e.progress(Progress{Step: StepAssets, State: Started})
+
+	if !e.NeedsUpdates() {
+		e.progress(Progress{Step: StepAssets, State: Succeeded})
+		return nil
+	}
+
+	e.progress(Progress{Step: StepAssets, State: Warned, Message: "Needs Updates"})
+
+	err := e.runner.Do(fmt.Sprintf("download %s and unpack it into %s", path.AssetURL(e.version), e.homeDir), e.downloadAssets)
+	if err != nil {
+		return err
+	}
+
+	err = e.runner.Do("pin the tools that come with the assets into "+path.ToolsDir(e.homeDir), e.installBundledTools)
+	if err != nil {
+		return err
+	}
+
+	// new assets may require other versions of dependencies
+	return e.runner.Do("check the dependencies required by the new assets", e.CheckDependencies)
+}
+
+func (e *Environment) downloadAssets() error {
+	var (
+		messageChan = make(chan string, 10)
+		doneChan    = make(chan bool)
+	)
+
+	go func() {
+		for {
+			select {
+			case <-doneChan:
+				return
+			case m := <-messageChan:
+				e.progress(Progress{Step: StepAssets, State: Info, Message: m})
+			}
+		}
+	}()
+
+	err := web.DownloadAssets(e.version, e.homeDir, messageChan)
+	close(doneChan)
+	return err
+}
+
+func (e *Environment) boot(cpu string, memory string, disk string) error {
+	err := e.runner.Remove(path.Pidpath(e.homeDir))
+	if err != nil {
+		return err
+	}
+
+	return e.runner.Start(Command{
+		Path: e.ToolPath("linuxkit"),
+		Args: []string{
+			"run", "hyperkit",
+			"-console-file",
+			"-iso", "-uefi",
+			"-cpus=" + cpu, "-mem=" + memory,
+			"-disk", "size=" + disk + "G",
+			"-networking", "vpnkit",
+			"-vpnkit", filepath.Join(path.AssetDir(e.homeDir), "vpnkit"),
+			"-publish", "9999:9999/tcp",
+			"-publish", "9998:9998/tcp",
+			"-state", path.LinuxkitStatePath(e.homeDir),
+			path.EFIisoPath(e.homeDir),
+		},
+		LogFile: filepath.Join(e.homeDir, "linuxkit.log"),
+	})
+}
+
+func (e *Environment) deployDirector(p preset.Preset) error {
+	err := e.runner.Do("back up "+path.BoshStateJSONPath(e.homeDir)+" into "+path.BoshStateBackupsDir(e.homeDir), func() error {
+		return backup.Rotate(path.BoshStateJSONPath(e.homeDir), path.BoshStateBackupsDir(e.homeDir), 5)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up bosh state file: %s", err)
+	}
+
+	err = e.resetBOSHStateJSON()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"create-env", filepath.Join(path.BoshDeploymentDir(e.homeDir), "bosh.yml"),
+		"-o", filepath.Join(path.BoshDeploymentDir(e.homeDir), "jumpbox-user.yml"),
+		"-o", filepath.Join(path.BoshOperationsDir(e.homeDir), "runc-cpi.yml"),
+	}
+
+	for _, opsFile := range p.OpsFiles {
+		args = append(args, "-o", opsFile)
+	}
+
+	return e.runner.Run(Command{
+		Path: e.ToolPath("bosh"),
+		Args: append(args,
+			"--state", path.BoshStateJSONPath(e.homeDir),
+			"--vars-store", path.BoshCredsPath(e.homeDir),
+			"-v", "director_name=director",
+			"-v", "external_cpid_ip=127.0.0.1",
+			"-v", "internal_cpid_ip="+e.network.CPIIP,
+			"-v", "internal_nameserver="+e.network.Nameserver,
+			"-v", "internal_ip="+e.network.DirectorIP,
+			"-v", "internal_gw="+e.network.Gateway,
+			"-v", "internal_cidr="+e.network.CIDR),
+		Stdout: e.output,
+		Stderr: e.output,
+	})
+}
+
+func (e *Environment) resetBOSHStateJSON() error {
+	_, err := os.Stat(path.BoshStateJSONPath(e.homeDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	mapping := map[string]interface{}{}
+
+	data, err := ioutil.ReadFile(path.BoshStateJSONPath(e.homeDir))
+	if err != nil {
+		return fmt.Errorf("failed to read bosh state file: %s", err)
+	}
+
+	json.Unmarshal(data, &mapping)
+	delete(mapping, "current_manifest_sha")
+	newContents, _ := json.Marshal(mapping)
+
+	return e.runner.WriteFile(path.BoshStateJSONPath(e.homeDir), newContents, 0600)
+}
+
+func (e *Environment) configureDirector(p preset.Preset) error {
+	creds := []struct {
+		path string
+		dst  string
+		perm os.FileMode
+	}{
+		{"/director_ssl/ca", path.BoshCACertPath(e.homeDir), 0644},
+		{"/jumpbox_ssh/private_key", path.BoshGWPrivateKeyPath(e.homeDir), 0600},
+	}
+
+	for _, c := range creds {
+		var stdout, stderr bytes.Buffer
+
+		command := Command{
+			Path:   e.ToolPath("bosh"),
+			Args:   []string{"int", path.BoshCredsPath(e.homeDir), "--path", c.path},
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+
+		err := e.runner.Run(command)
+		if err != nil {
+			return fmt.Errorf("failed to execute '%s': %s: %s", command, err, stderr.String())
+		}
+
+		err = e.runner.WriteFile(c.dst, stdout.Bytes(), c.perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	// writing over an existing key leaves its mode as it was
+	err := e.runner.Do("chmod 0600 "+path.BoshGWPrivateKeyPath(e.homeDir), func() error {
+		return os.Chmod(path.BoshGWPrivateKeyPath(e.homeDir), 0600)
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.reconcileConfigs(p)
+}
+
+func (e *Environment) checkNetworkAddrs() error {
+	assigned, err := hostnet.Assigned()
+	if err != nil {
+		return err
+	}
+
+	if assigned[e.network.DirectorIP] {
+		return nil
+	}
+
+	return fmt.Errorf(`Your BOSH director will be accessible at %s. To make sure your requests
+target appropriately you must add the IP to your network interfaces, like so:
+
+$ blt net setup
+
+`, e.network.DirectorIP)
+}
+
+// checkNetworkRoutes makes sure that no route of the host
+// would swallow traffic meant for the BOSH Lit network
+func (e *Environment) checkNetworkRoutes() error {
+	routes, err := hostnet.Routes()
+	if err != nil {
+		return err
+	}
+
+	overlapping := hostnet.Overlapping(routes, e.network.Subnet())
+	if len(overlapping) == 0 {
+		return nil
+	}
+
+	var messages = []string{fmt.Sprintf("The BOSH Lit network of %s overlaps with the following routes of your machine:", e.network.CIDR)}
+	for _, r := range overlapping {
+		messages = append(messages, fmt.Sprintf("  %s via %s", r.Destination, r.Interface))
+	}
+
+	messages = append(messages, fmt.Sprintf(`
+Your BOSH director would be unreachable. Choose a different network in %s, like so:
+
+network:
+  director_ip: 172.31.0.4
+  cidr: 172.31.0.0/16
+  gateway: 172.31.0.1`, path.ConfigPath(e.homeDir)))
+
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
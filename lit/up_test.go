@@ -0,0 +1,265 @@
+package lit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aemengo/blt/lock"
+	"github.com/aemengo/blt/path"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpFromBoot(t *testing.T) {
+	home := tempHome(t)
+	runner := &FakeRunner{
+		Outputs: []FakeOutput{
+			{Prefix: "bosh int " + path.BoshCredsPath(home) + " --path /director_ssl/ca", Stdout: "ca"},
+			{Prefix: "bosh int", Stdout: "key"},
+		},
+	}
+
+	var progress []Progress
+	e := New(Options{
+		HomeDir:  home,
+		Runner:   runner,
+		Progress: func(p Progress) { progress = append(progress, p) },
+	})
+
+	err := e.Up(context.Background(), UpOptions{From: PhaseBoot})
+	if err != nil {
+		t.Fatalf("Up failed: %s", err)
+	}
+
+	expectLines(t, "steps", withoutHome(runner.Steps, home), []string{
+		"rm -rf HOME/state/linuxkit/hyperkit.pid",
+		"linuxkit run hyperkit -console-file -iso -uefi -cpus=4 -mem=4096 -disk size=40G -networking vpnkit -vpnkit HOME/assets/vpnkit -publish 9999:9999/tcp -publish 9998:9998/tcp -state HOME/state/linuxkit HOME/assets/bosh-lit-efi.iso > HOME/linuxkit.log 2>&1 &",
+		"write HOME/state/up.json (61 bytes, mode 0644)",
+		"wait up to 1m0s for the VM to be running",
+		"write HOME/state/up.json (68 bytes, mode 0644)",
+		"back up HOME/state/bosh/state.json into HOME/state/backups",
+		"bosh create-env HOME/assets/bosh-deployment/bosh.yml -o HOME/assets/bosh-deployment/jumpbox-user.yml -o HOME/assets/operations/runc-cpi.yml --state HOME/state/bosh/state.json --vars-store HOME/state/bosh/creds.yml -v director_name=director -v external_cpid_ip=127.0.0.1 -v internal_cpid_ip=192.168.65.3 -v internal_nameserver=192.168.65.1 -v internal_ip=10.0.0.4 -v internal_gw=10.0.0.1 -v internal_cidr=10.0.0.0/16",
+		"write HOME/state/up.json (86 bytes, mode 0644)",
+		"bosh int HOME/state/bosh/creds.yml --path /director_ssl/ca",
+		"write HOME/state/bosh/ca.crt (2 bytes, mode 0644)",
+		"bosh int HOME/state/bosh/creds.yml --path /jumpbox_ssh/private_key",
+		"write HOME/state/bosh/gw_id_rsa (3 bytes, mode 0600)",
+		"chmod 0600 HOME/state/bosh/gw_id_rsa",
+		"update cloud/default config on the director with HOME/assets/operations/cloud-config.yml, unless it has one",
+		"write HOME/state/up.json (98 bytes, mode 0644)",
+		"write HOME/state/up.json (108 bytes, mode 0644)",
+		"rm -rf HOME/state/up.json",
+	})
+
+	expected := []Progress{
+		{State: Info, Message: "Resuming from the boot phase\n"},
+		{Step: StepBoot, State: Started},
+		{Step: StepBoot, State: Succeeded},
+		{Step: StepWait, State: Started},
+		{Step: StepWait, State: Succeeded},
+		{Step: StepDeploy, State: Started},
+		{Step: StepDeploy, State: Succeeded},
+		{Step: StepConfigure, State: Started},
+		{Step: StepConfigure, State: Succeeded},
+	}
+
+	if !reflect.DeepEqual(progress, expected) {
+		t.Fatalf("expected progress %v, got %v", expected, progress)
+	}
+}
+
+func TestUpStopsAtTheFailingStep(t *testing.T) {
+	home := tempHome(t)
+	runner := &FakeRunner{
+		Errors: map[string]error{"bosh create-env": errors.New("create-env failed")},
+	}
+
+	var failed []string
+	e := New(Options{
+		HomeDir: home,
+		Runner:  runner,
+		Progress: func(p Progress) {
+			if p.State == Failed {
+				failed = append(failed, p.Step)
+			}
+		},
+	})
+
+	err := e.Up(context.Background(), UpOptions{From: PhaseBoot})
+	if err == nil || err.Error() != "create-env failed" {
+		t.Fatalf("expected Up to fail with the error of create-env, got: %v", err)
+	}
+
+	last := runner.Steps[len(runner.Steps)-1]
+	if !strings.HasPrefix(last, "bosh create-env") {
+		t.Fatalf("expected Up to stop at create-env, stopped at: %s", last)
+	}
+
+	expectLines(t, "failed steps", failed, []string{StepDeploy})
+}
+
+func TestUpDryRun(t *testing.T) {
+	home := tempHome(t)
+
+	var output bytes.Buffer
+	e := New(Options{HomeDir: home, Runner: DryRunner{Output: &output}})
+
+	err := e.Up(context.Background(), UpOptions{From: PhaseBoot})
+	if err != nil {
+		t.Fatalf("Up failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	expectLines(t, "output", withoutHome(lines, home), []string{
+		"  rm -rf HOME/state/linuxkit/hyperkit.pid",
+		"  linuxkit run hyperkit -console-file -iso -uefi -cpus=4 -mem=4096 -disk size=40G -networking vpnkit -vpnkit HOME/assets/vpnkit -publish 9999:9999/tcp -publish 9998:9998/tcp -state HOME/state/linuxkit HOME/assets/bosh-lit-efi.iso > HOME/linuxkit.log 2>&1 &",
+		"  write HOME/state/up.json (61 bytes, mode 0644)",
+		"  wait up to 1m0s for the VM to be running",
+		"  write HOME/state/up.json (68 bytes, mode 0644)",
+		"  back up HOME/state/bosh/state.json into HOME/state/backups",
+		"  bosh create-env HOME/assets/bosh-deployment/bosh.yml -o HOME/assets/bosh-deployment/jumpbox-user.yml -o HOME/assets/operations/runc-cpi.yml --state HOME/state/bosh/state.json --vars-store HOME/state/bosh/creds.yml -v director_name=director -v external_cpid_ip=127.0.0.1 -v internal_cpid_ip=192.168.65.3 -v internal_nameserver=192.168.65.1 -v internal_ip=10.0.0.4 -v internal_gw=10.0.0.1 -v internal_cidr=10.0.0.0/16",
+		"  write HOME/state/up.json (86 bytes, mode 0644)",
+		"  bosh int HOME/state/bosh/creds.yml --path /director_ssl/ca",
+		"  write HOME/state/bosh/ca.crt (0 bytes, mode 0644)",
+		"  bosh int HOME/state/bosh/creds.yml --path /jumpbox_ssh/private_key",
+		"  write HOME/state/bosh/gw_id_rsa (0 bytes, mode 0600)",
+		"  chmod 0600 HOME/state/bosh/gw_id_rsa",
+		"  update cloud/default config on the director with HOME/assets/operations/cloud-config.yml, unless it has one",
+		"  write HOME/state/up.json (98 bytes, mode 0644)",
+		"  write HOME/state/up.json (108 bytes, mode 0644)",
+		"  rm -rf HOME/state/up.json",
+	})
+
+	// not even the lock is taken
+	files, err := ioutil.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 0 {
+		t.Fatalf("expected a dry run to leave %s empty, found %s", home, files[0].Name())
+	}
+}
+
+func TestDown(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  DownOptions
+		steps []string
+	}{
+		{
+			name: "stops the VM",
+			steps: []string{
+				"close the connection that forwards from the host",
+				"stop the VM",
+				"rm -rf HOME/state/up.json",
+			},
+		},
+		{
+			name: "kills processes left behind when forced",
+			opts: DownOptions{Force: true},
+			steps: []string{
+				"close the connection that forwards from the host",
+				"stop the VM",
+				"rm -rf HOME/state/up.json",
+				"kill any hypervisor processes left behind for the VM",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := tempHome(t)
+			runner := &FakeRunner{}
+
+			err := New(Options{HomeDir: home, Runner: runner}).Down(context.Background(), test.opts)
+			if err != nil {
+				t.Fatalf("Down failed: %s", err)
+			}
+
+			expectLines(t, "steps", withoutHome(runner.Steps, home), test.steps)
+		})
+	}
+}
+
+func TestDownWhileLocked(t *testing.T) {
+	home := tempHome(t)
+
+	held, err := lock.Acquire(path.LockPath(home), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	runner := &FakeRunner{}
+	e := New(Options{HomeDir: home, Runner: runner})
+
+	err = e.Down(context.Background(), DownOptions{})
+	if err == nil || !strings.Contains(err.Error(), "your environment is being changed by") {
+		t.Fatalf("expected Down to fail on the lock, got: %v", err)
+	}
+
+	err = e.Down(context.Background(), DownOptions{Force: true})
+	if err != nil {
+		t.Fatalf("expected a forced Down to go ahead, got: %s", err)
+	}
+
+	if len(runner.Steps) != 4 {
+		t.Fatalf("expected a forced Down to carry out every step, got: %v", runner.Steps)
+	}
+}
+
+func TestFakeRunnerOutputs(t *testing.T) {
+	runner := &FakeRunner{
+		Outputs: []FakeOutput{
+			{Prefix: "bosh int creds.yml --path /a", Stdout: "a"},
+			{Prefix: "bosh int", Stdout: "any"},
+		},
+	}
+
+	for _, test := range []struct{ args, stdout string }{
+		{"--path /a", "a"},
+		{"--path /b", "any"},
+	} {
+		var stdout bytes.Buffer
+
+		err := runner.Run(Command{Path: "bosh", Args: append([]string{"int", "creds.yml"}, strings.Fields(test.args)...), Stdout: &stdout})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stdout.String() != test.stdout {
+			t.Errorf("expected bosh int creds.yml %s to print %q, got %q", test.args, test.stdout, stdout.String())
+		}
+	}
+}
+
+func tempHome(t *testing.T) string {
+	home, err := ioutil.TempDir("", "blt-lit-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(home) })
+	return home
+}
+
+func withoutHome(lines []string, home string) []string {
+	var result []string
+	for _, l := range lines {
+		result = append(result, strings.Replace(l, home, "HOME", -1))
+	}
+
+	return result
+}
+
+func expectLines(t *testing.T, what string, actual []string, expected []string) {
+	t.Helper()
+
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected %s\nexpected:\n%s\n\ngot:\n%s", what, strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
@@ -0,0 +1,106 @@
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Holder describes the process holding a lock
+type Holder struct {
+	Pid     int       `json:"pid"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+func (h Holder) String() string {
+	if h.Pid == 0 {
+		return "another blt command"
+	}
+
+	return fmt.Sprintf("'%s' (pid %d, started %s)", h.Command, h.Pid, h.Started.Format(time.RFC1123))
+}
+
+// HeldError is returned when the lock is held by another process
+type HeldError struct {
+	File   string
+	Holder Holder
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s is locked by %s", e.File, e.Holder)
+}
+
+// Lock is an advisory lock on a file. It is released by the kernel
+// when the process holding it exits, crashed or not, so that a lock
+// is never left stale: the holder recorded in the file by a process
+// that is gone is simply overwritten by the next one.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock on the file, failing with a *HeldError
+// when another process holds it, unless told to block until then
+func Acquire(file string, block bool) (*Lock, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_EX
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		return nil, &HeldError{File: file, Holder: Read(file)}
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %s", file, err)
+	}
+
+	data, _ := json.Marshal(Holder{
+		Pid:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+		Started: time.Now(),
+	})
+
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to record holder of %s: %s", file, err)
+	}
+
+	return &Lock{file: f}, nil
+}
+
+// Read returns the holder recorded in the lock file, which
+// is left blank when there is none that can be made out
+func Read(file string) Holder {
+	var h Holder
+
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		json.Unmarshal(data, &h)
+	}
+
+	return h
+}
+
+func (l *Lock) Release() error {
+	l.file.Truncate(0)
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	return l.file.Close()
+}
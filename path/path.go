@@ -29,6 +29,10 @@ func BoshStateJSONPath(homedir string) string {
 	return filepath.Join(BoshStatePath(homedir), "state.json")
 }
 
+func BoshStateBackupsDir(homedir string) string {
+	return filepath.Join(StateDir(homedir), "backups")
+}
+
 func BoshCACertPath(homedir string) string {
 	return filepath.Join(BoshStatePath(homedir), "ca.crt")
 }
@@ -37,6 +41,10 @@ func BoshGWPrivateKeyPath(homedir string) string {
 	return filepath.Join(BoshStatePath(homedir), "gw_id_rsa")
 }
 
+func GeneratedCloudConfigPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "cloud-config.yml")
+}
+
 func Pidpath(homedir string) string {
 	return filepath.Join(LinuxkitStatePath(homedir), "hyperkit.pid")
 }
@@ -54,7 +62,75 @@ func BoshOperationsDir(homedir string) string {
 }
 
 func AssetVersionPath(homedir string) string {
-	return filepath.Join(AssetDir(homedir),  "version")
+	return filepath.Join(AssetDir(homedir), "version")
+}
+
+func DependenciesPath(homedir string) string {
+	return filepath.Join(AssetDir(homedir), "dependencies.yml")
+}
+
+func ConfigPath(homedir string) string {
+	return filepath.Join(homedir, "config.yml")
+}
+
+func ConfigsDir(homedir string) string {
+	return filepath.Join(homedir, "configs")
+}
+
+func PresetsDir(homedir string) string {
+	return filepath.Join(homedir, "presets")
+}
+
+func PresetPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "preset")
+}
+
+func ForwardsPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "forwards.json")
+}
+
+func UpProgressPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "up.json")
+}
+
+func JumpboxControlPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "jumpbox.sock")
+}
+
+func VPNKitPortSocketPath(homedir string) string {
+	return filepath.Join(LinuxkitStatePath(homedir), "vpnkit_port.sock")
+}
+
+func ReverseControlPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "reverse.sock")
+}
+
+func ReverseForwardsPath(homedir string) string {
+	return filepath.Join(StateDir(homedir), "reverse-forwards.json")
+}
+
+func EphemeralPath(homedir string) string {
+	return filepath.Join(homedir, "ephemeral")
+}
+
+func LockPath(homedir string) string {
+	return filepath.Join(homedir, "blt.lock")
+}
+
+func ToolsDir(homedir string) string {
+	return filepath.Join(homedir, "tools")
+}
+
+func CacheDir(homedir string) string {
+	return filepath.Join(homedir, "cache")
+}
+
+func StemcellCacheDir(homedir string) string {
+	return filepath.Join(CacheDir(homedir), "stemcells")
+}
+
+func ReleaseCacheDir(homedir string) string {
+	return filepath.Join(CacheDir(homedir), "releases")
 }
 
 func AssetURL(version string) string {
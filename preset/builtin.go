@@ -0,0 +1,29 @@
+package preset
+
+var builtins = map[string]string{
+	"default": `
+name: default
+description: A minimal BOSH director with the pre-configured cloud-config
+cpu: 4
+memory: 4096
+disk: 40
+`,
+
+	"cf": `
+name: cf
+description: A BOSH director sized and configured for cf-deployment
+cpu: 4
+memory: 8192
+disk: 80
+cloud_config: operations/cf/cloud-config.yml
+runtime_configs:
+  dns: bosh-deployment/runtime-configs/dns.yml
+ops_files:
+- bosh-deployment/uaa.yml
+- bosh-deployment/credhub.yml
+expose:
+- 10.244.0.34:80:10.244.0.34:80
+- 10.244.0.34:443:10.244.0.34:443
+- 10.244.0.34:2222:10.244.0.34:2222
+`,
+}
@@ -0,0 +1,184 @@
+package preset
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const Default = "default"
+
+type Preset struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+
+	// Extends names another preset whose
+	// values are used unless overridden
+	Extends string `yaml:"extends"`
+
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+	Disk   string `yaml:"disk"`
+
+	CloudConfig    string            `yaml:"cloud_config"`
+	RuntimeConfigs map[string]string `yaml:"runtime_configs"`
+	OpsFiles       []string          `yaml:"ops_files"`
+	Expose         []string          `yaml:"expose"`
+}
+
+// Load returns the named preset, looking in the given directory
+// first and then among the built-in presets. Relative file paths
+// are resolved against the directory of user presets, and against
+// the asset directory for built-in ones.
+func Load(name string, dir string, assetDir string) (Preset, error) {
+	return load(name, dir, assetDir, map[string]bool{})
+}
+
+// List returns all user and built-in presets, sorted by name
+func List(dir string, assetDir string) ([]Preset, error) {
+	names := map[string]bool{}
+	for name := range builtins {
+		names[name] = true
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read presets at %s: %s", dir, err)
+	}
+
+	for _, f := range files {
+		if ext := filepath.Ext(f.Name()); !f.IsDir() && ext == ".yml" {
+			names[strings.TrimSuffix(f.Name(), ext)] = true
+		}
+	}
+
+	var presets []Preset
+	for name := range names {
+		p, err := Load(name, dir, assetDir)
+		if err != nil {
+			return nil, err
+		}
+
+		presets = append(presets, p)
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+
+	return presets, nil
+}
+
+func load(name string, dir string, assetDir string, seen map[string]bool) (Preset, error) {
+	if seen[name] {
+		return Preset{}, fmt.Errorf("preset '%s' extends itself", name)
+	}
+	seen[name] = true
+
+	data, baseDir, err := read(name, dir, assetDir)
+	if err != nil {
+		return Preset{}, err
+	}
+
+	var p Preset
+	err = yaml.UnmarshalStrict(data, &p)
+	if err != nil {
+		return Preset{}, fmt.Errorf("failed to parse preset '%s': %s", name, err)
+	}
+
+	p.Name = name
+	p.resolvePaths(baseDir)
+
+	if p.Extends == "" {
+		return p, nil
+	}
+
+	parent, err := load(p.Extends, dir, assetDir, seen)
+	if err != nil {
+		return Preset{}, err
+	}
+
+	return parent.merge(p), nil
+}
+
+func read(name string, dir string, assetDir string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name+".yml"))
+	if err == nil {
+		return data, dir, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("failed to read preset '%s': %s", name, err)
+	}
+
+	contents, ok := builtins[name]
+	if !ok {
+		return nil, "", fmt.Errorf("preset '%s' does not exist", name)
+	}
+
+	return []byte(contents), assetDir, nil
+}
+
+func (p *Preset) resolvePaths(baseDir string) {
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+
+		return filepath.Join(baseDir, file)
+	}
+
+	p.CloudConfig = resolve(p.CloudConfig)
+
+	for i := range p.OpsFiles {
+		p.OpsFiles[i] = resolve(p.OpsFiles[i])
+	}
+
+	for name := range p.RuntimeConfigs {
+		p.RuntimeConfigs[name] = resolve(p.RuntimeConfigs[name])
+	}
+}
+
+// merge returns the preset with the non-empty
+// values of the child layered on top
+func (p Preset) merge(child Preset) Preset {
+	result := p
+	result.Name = child.Name
+	result.Extends = child.Extends
+
+	if child.Description != "" {
+		result.Description = child.Description
+	}
+
+	if child.CPU != "" {
+		result.CPU = child.CPU
+	}
+
+	if child.Memory != "" {
+		result.Memory = child.Memory
+	}
+
+	if child.Disk != "" {
+		result.Disk = child.Disk
+	}
+
+	if child.CloudConfig != "" {
+		result.CloudConfig = child.CloudConfig
+	}
+
+	result.RuntimeConfigs = map[string]string{}
+	for name, file := range p.RuntimeConfigs {
+		result.RuntimeConfigs[name] = file
+	}
+	for name, file := range child.RuntimeConfigs {
+		result.RuntimeConfigs[name] = file
+	}
+
+	result.OpsFiles = append(append([]string{}, p.OpsFiles...), child.OpsFiles...)
+	result.Expose = append(append([]string{}, p.Expose...), child.Expose...)
+	return result
+}
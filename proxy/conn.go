@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"time"
+)
+
+// commandConn is a connection over the standard input and
+// output of a command, like "ssh -W host:port"
+type commandConn struct {
+	command *exec.Cmd
+	reader  io.ReadCloser
+	writer  io.WriteCloser
+	addr    string
+}
+
+// DialCommand starts the command and returns a connection
+// to the address over the standard input and output of it
+func DialCommand(command *exec.Cmd, addr string) (net.Conn, error) {
+	writer, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = command.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %s", addr, err)
+	}
+
+	return &commandConn{command: command, reader: reader, writer: writer, addr: addr}, nil
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+func (c *commandConn) Close() error {
+	c.writer.Close()
+	c.reader.Close()
+
+	if c.command.Process != nil {
+		c.command.Process.Kill()
+	}
+
+	c.command.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return addr("localhost")
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return addr(c.addr)
+}
+
+// deadlines are not supported by pipes of a command, and
+// are left to the proxied applications on either end
+
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type addr string
+
+func (a addr) Network() string { return "tcp" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Dialer opens a connection to a host:port address
+type Dialer func(addr string) (net.Conn, error)
+
+// ServeSOCKS accepts SOCKS5 clients on the listener and
+// connects them to where they ask through the dialer
+func ServeSOCKS(l net.Listener, dial Dialer) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			remote, err := socksHandshake(conn, dial)
+			if err != nil {
+				return
+			}
+
+			pipe(conn, remote)
+		}()
+	}
+}
+
+// ServeHTTP accepts HTTP proxy clients on the listener, both plain
+// requests and CONNECT tunnels, and dials upstream through the dialer
+func ServeHTTP(l net.Listener, dial Dialer) error {
+	return http.Serve(l, &httpProxy{
+		dial: dial,
+		transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return dial(addr)
+			},
+		},
+	})
+}
+
+const (
+	socksVersion     = 5
+	socksNoAuth      = 0
+	socksNoMethod    = 0xff
+	socksConnect     = 1
+	socksIPv4        = 1
+	socksDomain      = 3
+	socksIPv6        = 4
+	socksSucceeded   = 0
+	socksFailure     = 1
+	socksUnsupported = 7
+)
+
+func socksHandshake(conn net.Conn, dial Dialer) (net.Conn, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	_, err = io.ReadFull(conn, methods)
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsByte(methods, socksNoAuth) {
+		conn.Write([]byte{socksVersion, socksNoMethod})
+		return nil, errors.New("SOCKS client requires authentication")
+	}
+
+	_, err = conn.Write([]byte{socksVersion, socksNoAuth})
+	if err != nil {
+		return nil, err
+	}
+
+	request := make([]byte, 4)
+	_, err = io.ReadFull(conn, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if request[1] != socksConnect {
+		socksReply(conn, socksUnsupported)
+		return nil, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		size := net.IPv4len
+		if request[3] == socksIPv6 {
+			size = net.IPv6len
+		}
+
+		ip := make([]byte, size)
+		_, err = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case socksDomain:
+		length := make([]byte, 1)
+		_, err = io.ReadFull(conn, length)
+		if err != nil {
+			return nil, err
+		}
+
+		name := make([]byte, length[0])
+		_, err = io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		socksReply(conn, socksUnsupported)
+		return nil, fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	port := make([]byte, 2)
+	_, err = io.ReadFull(conn, port)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := dial(net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		socksReply(conn, socksFailure)
+		return nil, err
+	}
+
+	err = socksReply(conn, socksSucceeded)
+	if err != nil {
+		remote.Close()
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+func socksReply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+type httpProxy struct {
+	dial      Dialer
+	transport *http.Transport
+}
+
+// hopHeaders only apply to the connection
+// between the client and the proxy
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func (p *httpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "this is a proxy, requests must have an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	outgoing := r.WithContext(r.Context())
+	outgoing.RequestURI = ""
+	outgoing.Header = cloneHeader(r.Header)
+	for _, h := range hopHeaders {
+		outgoing.Header.Del(h)
+	}
+
+	resp, err := p.transport.RoundTrip(outgoing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (p *httpProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	remote, err := p.dial(r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		remote.Close()
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		remote.Close()
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if err != nil {
+		remote.Close()
+		return
+	}
+
+	pipe(conn, remote)
+}
+
+// pipe copies between both connections until
+// either one is done, then closes the remote one
+func pipe(local net.Conn, remote net.Conn) {
+	var once sync.Once
+	done := make(chan bool)
+	finish := func() {
+		once.Do(func() { close(done) })
+	}
+
+	go func() {
+		io.Copy(remote, local)
+		finish()
+	}()
+
+	go func() {
+		io.Copy(local, remote)
+		finish()
+	}()
+
+	<-done
+	remote.Close()
+}
+
+func cloneHeader(h http.Header) http.Header {
+	result := http.Header{}
+	for key, values := range h {
+		result[key] = append([]string(nil), values...)
+	}
+
+	return result
+}
+
+func containsByte(list []byte, b byte) bool {
+	for _, item := range list {
+		if item == b {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Compiled describes a release compiled
+// against a particular stemcell
+type Compiled struct {
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	OS              string `json:"os"`
+	StemcellVersion string `json:"stemcell_version"`
+
+	// Path is the location of the
+	// release tarball in the cache
+	Path string `json:"-"`
+}
+
+func (c Compiled) String() string {
+	return fmt.Sprintf("%s/%s (%s/%s)", c.Name, c.Version, c.OS, c.StemcellVersion)
+}
+
+func (c Compiled) filename() string {
+	return fmt.Sprintf("%s-%s-%s-%s.tgz", c.Name, c.Version, c.OS, c.StemcellVersion)
+}
+
+// Has returns whether the compiled release is already cached
+func Has(dir string, c Compiled) bool {
+	_, err := os.Stat(metadataPath(filepath.Join(dir, c.filename())))
+	return err == nil
+}
+
+// Add moves the compiled release tarball at src into the
+// cache directory, recording what it was compiled against
+func Add(dir string, src string, c Compiled) (Compiled, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return Compiled{}, err
+	}
+
+	c.Path = filepath.Join(dir, c.filename())
+	err = os.Rename(src, c.Path)
+	if err != nil {
+		return Compiled{}, fmt.Errorf("failed to move %s into the cache: %s", src, err)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return Compiled{}, err
+	}
+
+	err = ioutil.WriteFile(metadataPath(c.Path), data, 0644)
+	if err != nil {
+		os.RemoveAll(c.Path)
+		return Compiled{}, err
+	}
+
+	return c, nil
+}
+
+// List returns the cached compiled releases sorted by name and version
+func List(dir string) ([]Compiled, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Compiled
+	for _, file := range files {
+		data, err := ioutil.ReadFile(metadataPath(file))
+		if err != nil {
+			continue
+		}
+
+		var c Compiled
+		err = json.Unmarshal(data, &c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %s: %s", file, err)
+		}
+
+		c.Path = file
+		releases = append(releases, c)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].String() < releases[j].String()
+	})
+
+	return releases, nil
+}
+
+func metadataPath(file string) string {
+	return file + ".json"
+}
@@ -0,0 +1,236 @@
+package stemcell
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Stemcell struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	SHA1    string `json:"sha1"`
+
+	// Path is the location of the
+	// stemcell tarball in the cache
+	Path string `json:"-"`
+}
+
+func (s Stemcell) String() string {
+	return s.Name + "/" + s.Version
+}
+
+// Verify checks the cached tarball against the
+// checksum recorded when it was added
+func (s Stemcell) Verify() error {
+	sha, err := checksum(s.Path)
+	if err != nil {
+		return err
+	}
+
+	if sha != s.SHA1 {
+		return fmt.Errorf("checksum validation error with: %s", s.Path)
+	}
+
+	return nil
+}
+
+// Add copies the stemcell tarball at src into the cache directory,
+// replacing any cached stemcell with the same name and version.
+// When a checksum is given, the tarball must match it.
+func Add(dir string, src string, sha string) (Stemcell, error) {
+	s, err := inspect(src)
+	if err != nil {
+		return Stemcell{}, err
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return Stemcell{}, err
+	}
+
+	s.Path = filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", s.Name, s.Version))
+	s.SHA1, err = copyFile(src, s.Path+".tmp")
+	if err != nil {
+		return Stemcell{}, err
+	}
+
+	if sha != "" && strings.TrimSpace(sha) != s.SHA1 {
+		os.RemoveAll(s.Path + ".tmp")
+		return Stemcell{}, fmt.Errorf("checksum validation error with: %s", src)
+	}
+
+	err = os.Rename(s.Path+".tmp", s.Path)
+	if err != nil {
+		return Stemcell{}, err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return Stemcell{}, err
+	}
+
+	err = ioutil.WriteFile(metadataPath(s.Path), data, 0644)
+	if err != nil {
+		os.RemoveAll(s.Path)
+		return Stemcell{}, err
+	}
+
+	return s, nil
+}
+
+// List returns the cached stemcells sorted by name and version
+func List(dir string) ([]Stemcell, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stemcells []Stemcell
+	for _, file := range files {
+		data, err := ioutil.ReadFile(metadataPath(file))
+		if err != nil {
+			continue
+		}
+
+		var s Stemcell
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %s: %s", file, err)
+		}
+
+		s.Path = file
+		stemcells = append(stemcells, s)
+	}
+
+	sort.Slice(stemcells, func(i, j int) bool {
+		return stemcells[i].String() < stemcells[j].String()
+	})
+
+	return stemcells, nil
+}
+
+// Remove deletes the cached stemcell referred to as "name/version"
+func Remove(dir string, id string) error {
+	stemcells, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stemcells {
+		if s.String() != id {
+			continue
+		}
+
+		err = os.RemoveAll(metadataPath(s.Path))
+		if err != nil {
+			return err
+		}
+
+		return os.RemoveAll(s.Path)
+	}
+
+	return fmt.Errorf("stemcell '%s' is not cached", id)
+}
+
+func metadataPath(file string) string {
+	return file + ".json"
+}
+
+// inspect reads the name and version out of
+// the stemcell.MF found inside the tarball
+func inspect(file string) (Stemcell, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Stemcell{}, fmt.Errorf("failed to open %s: %s", file, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Stemcell{}, fmt.Errorf("%s is not a stemcell tarball: %s", file, err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return Stemcell{}, fmt.Errorf("%s is not a stemcell tarball: missing stemcell.MF", file)
+		}
+
+		if err != nil {
+			return Stemcell{}, fmt.Errorf("failed to read %s: %s", file, err)
+		}
+
+		if filepath.Clean(header.Name) != "stemcell.MF" {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return Stemcell{}, fmt.Errorf("failed to read %s: %s", file, err)
+		}
+
+		var s Stemcell
+		err = yaml.Unmarshal(data, &s)
+		if err != nil {
+			return Stemcell{}, fmt.Errorf("failed to parse stemcell.MF of %s: %s", file, err)
+		}
+
+		if s.Name == "" || s.Version == "" {
+			return Stemcell{}, fmt.Errorf("stemcell.MF of %s is missing a name or version", file)
+		}
+
+		s.SHA1 = ""
+		return s, nil
+	}
+}
+
+func copyFile(src string, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %s", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %s", dst, err)
+	}
+	defer out.Close()
+
+	hash := sha1.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		os.RemoveAll(dst)
+		return "", fmt.Errorf("failed to copy %s to %s: %s", src, dst, err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum([]byte{})), nil
+}
+
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %s", file, err)
+	}
+	defer f.Close()
+
+	hash := sha1.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", file, err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum([]byte{})), nil
+}
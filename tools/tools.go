@@ -0,0 +1,252 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aemengo/blt/versions"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Tool is a CLI binary pinned under <dir>/<version>/<name>,
+// next to a <name>.sha256 file holding its checksum
+type Tool struct {
+	Name    string
+	Version string
+	Path    string
+	SHA256  string
+}
+
+// Verify makes sure that the binary has not changed since it was installed
+func (t Tool) Verify() error {
+	sum, err := checksum(t.Path)
+	if err != nil {
+		return err
+	}
+
+	if sum != t.SHA256 {
+		return fmt.Errorf("%s does not match its checksum of %s", t.Path, t.SHA256)
+	}
+
+	return nil
+}
+
+// VerifySHA256 makes sure that the file at src has the expected sha256
+// checksum, so that it can be trusted to run before it is installed
+func VerifySHA256(src string, expectedSHA string) error {
+	sum, err := checksum(src)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(sum, expectedSHA) {
+		return fmt.Errorf("%s has a sha256 checksum of %s, expected %s", src, sum, expectedSHA)
+	}
+
+	return nil
+}
+
+// Install copies the binary at src into the directory of pinned tools.
+// When expectedSHA is given, the binary must match that sha256 checksum.
+func Install(dir string, name string, version string, src string, expectedSHA string) (Tool, error) {
+	if _, err := versions.Parse(version); err != nil {
+		return Tool{}, err
+	}
+
+	versionDir := filepath.Join(dir, version)
+	err := os.MkdirAll(versionDir, os.ModePerm)
+	if err != nil {
+		return Tool{}, err
+	}
+
+	tool := Tool{Name: name, Version: version, Path: filepath.Join(versionDir, name)}
+	tmpFile := tool.Path + ".tmp"
+	defer os.RemoveAll(tmpFile)
+
+	tool.SHA256, err = copyFile(src, tmpFile)
+	if err != nil {
+		return Tool{}, fmt.Errorf("failed to install %s: %s", src, err)
+	}
+
+	if expectedSHA != "" && !strings.EqualFold(tool.SHA256, expectedSHA) {
+		return Tool{}, fmt.Errorf("%s has a sha256 checksum of %s, expected %s", src, tool.SHA256, expectedSHA)
+	}
+
+	err = os.Chmod(tmpFile, 0755)
+	if err != nil {
+		return Tool{}, err
+	}
+
+	err = os.Rename(tmpFile, tool.Path)
+	if err != nil {
+		return Tool{}, err
+	}
+
+	return tool, ioutil.WriteFile(tool.Path+".sha256", []byte(tool.SHA256+"\n"), 0644)
+}
+
+// bundled describes a tool shipped with the assets, in tools/tools.yml
+type bundled struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	OS      string `yaml:"os"`
+	Path    string `yaml:"path"`
+	SHA256  string `yaml:"sha256"`
+}
+
+// InstallBundled pins the tools that the assets ship for this
+// operating system, if any, skipping those already installed
+func InstallBundled(assetDir string, dir string) ([]Tool, error) {
+	bundleDir := filepath.Join(assetDir, "tools")
+
+	data, err := ioutil.ReadFile(filepath.Join(bundleDir, "tools.yml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest []bundled
+	err = yaml.UnmarshalStrict(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", filepath.Join(bundleDir, "tools.yml"), err)
+	}
+
+	installed, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Tool
+	for _, b := range manifest {
+		if b.OS != runtime.GOOS {
+			continue
+		}
+
+		if t, ok := find(installed, b.Name, b.Version); ok && strings.EqualFold(t.SHA256, b.SHA256) {
+			continue
+		}
+
+		t, err := Install(dir, b.Name, b.Version, filepath.Join(bundleDir, b.Path), b.SHA256)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, t)
+	}
+
+	return result, nil
+}
+
+// List returns every pinned tool, ordered by name
+// and then from the highest version to the lowest
+func List(dir string) ([]Tool, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*", "*.sha256"))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Tool
+	for _, sumFile := range matches {
+		data, err := ioutil.ReadFile(sumFile)
+		if err != nil {
+			return nil, err
+		}
+
+		binary := strings.TrimSuffix(sumFile, ".sha256")
+		result = append(result, Tool{
+			Name:    filepath.Base(binary),
+			Version: filepath.Base(filepath.Dir(binary)),
+			Path:    binary,
+			SHA256:  strings.TrimSpace(string(data)),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+
+		a, _ := versions.Parse(result[i].Version)
+		b, _ := versions.Parse(result[j].Version)
+		return a.Compare(b) > 0
+	})
+
+	return result, nil
+}
+
+// Select returns the highest version of the named tool that
+// the constraint allows and that still matches its checksum
+func Select(tools []Tool, name string, constraint versions.Constraint) (Tool, bool) {
+	for _, t := range tools {
+		if t.Name != name {
+			continue
+		}
+
+		v, err := versions.Parse(t.Version)
+		if err != nil || !constraint.Allows(v) || t.Verify() != nil {
+			continue
+		}
+
+		return t, true
+	}
+
+	return Tool{}, false
+}
+
+func find(tools []Tool, name string, version string) (Tool, bool) {
+	for _, t := range tools {
+		if t.Name == name && t.Version == version {
+			return t, true
+		}
+	}
+
+	return Tool{}, false
+}
+
+func copyFile(src string, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
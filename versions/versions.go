@@ -0,0 +1,144 @@
+package versions
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted version like 6.4.1, compared numerically
+type Version []int
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// Extract returns the first dotted version found in the
+// output of a command, like "version 6.4.1-a1b2c3-2020-01-01"
+func Extract(output string) (Version, bool) {
+	match := versionPattern.FindString(output)
+	if match == "" {
+		return nil, false
+	}
+
+	v, err := Parse(match)
+	return v, err == nil
+}
+
+func Parse(s string) (Version, error) {
+	var v Version
+	for _, part := range strings.Split(strings.TrimPrefix(s, "v"), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("version '%s' must be made of numbers separated by dots", s)
+		}
+
+		v = append(v, n)
+	}
+
+	return v, nil
+}
+
+func (v Version) String() string {
+	var parts []string
+	for _, n := range v {
+		parts = append(parts, strconv.Itoa(n))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Compare returns -1, 0 or 1 when v is lower, equal or higher
+// than other, with missing parts counting as zero
+func (v Version) Compare(other Version) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		a, b := 0, 0
+		if i < len(v) {
+			a = v[i]
+		}
+
+		if i < len(other) {
+			b = other[i]
+		}
+
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Constraint bounds the versions of a dependency, the minimum
+// being the lowest allowed and the maximum the lowest not allowed
+type Constraint struct {
+	Min string `yaml:"min"`
+	Max string `yaml:"max"`
+}
+
+func (c Constraint) Allows(v Version) bool {
+	if min, err := Parse(c.Min); c.Min != "" && err == nil && v.Compare(min) < 0 {
+		return false
+	}
+
+	if max, err := Parse(c.Max); c.Max != "" && err == nil && v.Compare(max) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+func (c Constraint) String() string {
+	var bounds []string
+	if c.Min != "" {
+		bounds = append(bounds, ">= "+c.Min)
+	}
+
+	if c.Max != "" {
+		bounds = append(bounds, "< "+c.Max)
+	}
+
+	if len(bounds) == 0 {
+		return "any version"
+	}
+
+	return strings.Join(bounds, ", ")
+}
+
+// LoadConstraints reads the constraints that an asset bundle
+// declares per dependency name, which are optional:
+//
+//	bosh:
+//	  min: 6.0.0
+//	  max: 7.0.0
+func LoadConstraints(file string) (map[string]Constraint, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return map[string]Constraint{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var constraints map[string]Constraint
+	err = yaml.UnmarshalStrict(data, &constraints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+
+	for name, c := range constraints {
+		for _, bound := range []string{c.Min, c.Max} {
+			if _, err := Parse(bound); bound != "" && err != nil {
+				return nil, fmt.Errorf("invalid constraint of %s in %s: %s", name, file, err)
+			}
+		}
+	}
+
+	return constraints, nil
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/aemengo/blt/path"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// process is an entry of the process table, as reported by ps
+type process struct {
+	Pid     int
+	Started time.Time
+	Command string
+}
+
+// hypervisorCommands are the processes that linuxkit leaves
+// behind, each referencing the state directory in its arguments
+var hypervisorCommands = []string{"hyperkit", "linuxkit", "vpnkit"}
+
+const lstartLayout = "Mon Jan 2 15:04:05 2006"
+
+// listProcesses runs ps with the given selection, which is
+// every process when left out
+func listProcesses(selection ...string) ([]process, error) {
+	if len(selection) == 0 {
+		selection = []string{"-A"}
+	}
+
+	command := exec.Command("ps", append(selection, "-o", "pid=", "-o", "lstart=", "-o", "command=")...)
+	command.Env = append(os.Environ(), "LC_ALL=C")
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []process
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("ps listed an unexpected process: %s", line)
+		}
+
+		started, err := time.ParseInLocation(lstartLayout, strings.Join(fields[1:6], " "), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("ps listed an unexpected process: %s", line)
+		}
+
+		result = append(result, process{
+			Pid:     pid,
+			Started: started,
+			Command: strings.Join(fields[6:], " "),
+		})
+	}
+
+	return result, nil
+}
+
+// references tells whether the process is one of the hypervisor
+// commands, with the given directory among its arguments
+func (p process) references(dir string) bool {
+	fields := strings.Fields(p.Command)
+	if len(fields) == 0 {
+		return false
+	}
+
+	name := filepath.Base(fields[0])
+
+	known := false
+	for _, c := range hypervisorCommands {
+		if strings.Contains(name, c) {
+			known = true
+		}
+	}
+
+	if !known {
+		return false
+	}
+
+	for _, arg := range fields[1:] {
+		if arg == dir || strings.HasPrefix(arg, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHypervisor makes sure that the pid, read from the pid file written
+// at pidFileTime, still belongs to the hypervisor of the state directory
+// rather than to some other process that reused it, after a reboot say
+func isHypervisor(pid int, stateDir string, pidFileTime time.Time) bool {
+	processes, err := listProcesses("-p", strconv.Itoa(pid))
+	if err != nil || len(processes) != 1 {
+		return false
+	}
+
+	p := processes[0]
+	if !p.references(stateDir) || !strings.Contains(p.Command, "hyperkit") {
+		return false
+	}
+
+	// the hypervisor writes its pid file once started, a process
+	// started any later cannot have been the one that wrote it
+	return !p.Started.After(pidFileTime.Add(5 * time.Second))
+}
+
+// KillOrphans kills every hypervisor process referencing the
+// state directory, whether or not it is in the pid file, and
+// returns the pids that were killed
+func KillOrphans(homedir string) ([]int, error) {
+	stateDir := path.LinuxkitStatePath(homedir)
+
+	processes, err := listProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %s", err)
+	}
+
+	var killed []int
+	for _, p := range processes {
+		if p.Pid == os.Getpid() || !p.references(stateDir) {
+			continue
+		}
+
+		err = syscall.Kill(p.Pid, syscall.SIGKILL)
+		if err != nil && err != syscall.ESRCH {
+			return killed, fmt.Errorf("failed to kill '%s' (pid %d): %s", p.Command, p.Pid, err)
+		}
+
+		killed = append(killed, p.Pid)
+	}
+
+	err = os.RemoveAll(path.Pidpath(homedir))
+	if err != nil {
+		return killed, err
+	}
+
+	return killed, nil
+}
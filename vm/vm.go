@@ -2,13 +2,17 @@ package vm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/aemengo/blt/forward"
 	"github.com/aemengo/blt/path"
+	"github.com/aemengo/blt/vpnkit"
 	c1 "github.com/aemengo/bosh-runc-cpi/client"
 	c2 "github.com/aemengo/vpnkit-manager/client"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -19,6 +23,45 @@ const (
 	VMStatusUnresponsive
 )
 
+const (
+	cpiAddr    = "127.0.0.1:9999"
+	vpnkitAddr = "127.0.0.1:9998"
+)
+
+var (
+	ErrVMStopped         = errors.New("VM is stopped")
+	ErrCPIUnreachable    = errors.New("CPI is unreachable at " + cpiAddr)
+	ErrVPNKitUnreachable = errors.New("vpnkit-manager is unreachable at " + vpnkitAddr)
+)
+
+// Timeout bounds every call to the services of the VM,
+// save for Prune which takes as long as the disk needs
+var Timeout = 10 * time.Second
+
+// CallError is a failed call to a service of the VM, which is
+// one of the errors above so that callers can branch on it
+type CallError struct {
+	Kind error
+	Err  error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Kind
+}
+
+// Cause returns the kind of a *CallError, or err itself otherwise
+func Cause(err error) error {
+	if e, ok := err.(*CallError); ok {
+		return e.Kind
+	}
+
+	return err
+}
+
 type Status int
 
 func (s Status) String() string {
@@ -34,37 +77,46 @@ func (s Status) String() string {
 	return "Unknown"
 }
 
-func GetStatus(homedir string) Status {
+// Check returns nil when the VM is running and its services
+// respond, ErrVMStopped or the *CallError of the first that does not
+func Check(ctx context.Context, homedir string) error {
 	_, ok := fetchVMProcess(homedir)
 	if !ok {
-		return VMStatusStopped
+		return ErrVMStopped
 	}
 
-	ctx := context.Background()
-
-	err := c1.Ping(ctx, "127.0.0.1:9999")
+	err := pingCPI(ctx)
 	if err != nil {
-		return VMStatusUnresponsive
+		return err
 	}
 
-	err = c2.Ping(ctx, "127.0.0.1:9998")
-	if err != nil {
+	return pingVPNKit(ctx)
+}
+
+func GetStatus(ctx context.Context, homedir string) Status {
+	switch Check(ctx, homedir) {
+	case nil:
+		return VMStatusRunning
+	case ErrVMStopped:
+		return VMStatusStopped
+	default:
 		return VMStatusUnresponsive
 	}
-
-	return VMStatusRunning
 }
 
-func WaitForStatus(desiredStatus Status, homedir string, timeout time.Duration) error {
+func WaitForStatus(ctx context.Context, desiredStatus Status, homedir string, timeout time.Duration) error {
 	timeoutChan := time.After(timeout)
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-timeoutChan:
 			return fmt.Errorf("VM failed to reach a status of %s after %v", desiredStatus, timeout)
 		case <-ticker.C:
-			status := GetStatus(homedir)
+			status := GetStatus(ctx, homedir)
 			if status == desiredStatus {
 				return nil
 			}
@@ -72,22 +124,75 @@ func WaitForStatus(desiredStatus Status, homedir string, timeout time.Duration)
 	}
 }
 
-func Prune() error {
-	ctx := context.Background()
-	return c1.Prune(ctx, "127.0.0.1:9999")
+func Prune(ctx context.Context) error {
+	err := c1.Prune(ctx, cpiAddr)
+	if err != nil {
+		return classify(ctx, err, pingCPI)
+	}
+
+	return nil
 }
 
-func Forward(addresses []string) error {
-	ctx := context.Background()
-	return c2.Forward(ctx, "127.0.0.1:9998", addresses)
+// Forward exposes ports of the VM network on the host,
+// for both TCP and UDP depending on the protocol of each spec
+func Forward(ctx context.Context, specs []forward.Spec) error {
+	return callVPNKit(ctx, func(ctx context.Context) error {
+		return c2.Forward(ctx, vpnkitAddr, forward.Strings(specs))
+	})
 }
 
-func ListForwarded() ([]string, error) {
-	ctx := context.Background()
-	return c2.ListForwarded(ctx, "127.0.0.1:9998")
+// Unforward takes down forwards through the port socket of vpnkit,
+// which carries out the forwards of the vpnkit-manager
+func Unforward(ctx context.Context, homedir string, specs []forward.Spec) error {
+	var names []string
+	for _, s := range specs {
+		names = append(names, vpnkit.Name(s.Protocol, s.HostIP, s.HostPort, s.ContainerIP, s.ContainerPort))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	err := vpnkit.Remove(ctx, path.VPNKitPortSocketPath(homedir), names)
+	if err != nil {
+		return &CallError{Kind: ErrVPNKitUnreachable, Err: err}
+	}
+
+	return nil
 }
 
-func Stop(homedir string) {
+func ListForwarded(ctx context.Context) ([]forward.Spec, error) {
+	var addresses []string
+	err := callVPNKit(ctx, func(ctx context.Context) error {
+		var err error
+		addresses, err = c2.ListForwarded(ctx, vpnkitAddr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseForwarded(addresses), nil
+}
+
+// parseForwarded parses the addresses listed by the vpnkit-manager,
+// which carry a /udp suffix for UDP and no suffix for TCP. Addresses
+// that cannot be made out, which blt never forwards, are left out
+// rather than keeping every other forward from being listed.
+func parseForwarded(addresses []string) []forward.Spec {
+	var specs []forward.Spec
+	for _, a := range addresses {
+		s, err := forward.Parse(a, "")
+		if err != nil {
+			continue
+		}
+
+		specs = append(specs, s...)
+	}
+
+	return specs
+}
+
+func Stop(ctx context.Context, homedir string) {
 	process, ok := fetchVMProcess(homedir)
 	if !ok {
 		return
@@ -95,7 +200,7 @@ func Stop(homedir string) {
 
 	process.Signal(os.Interrupt)
 
-	err := WaitForStatus(VMStatusStopped, homedir, 20*time.Second)
+	err := WaitForStatus(ctx, VMStatusStopped, homedir, 20*time.Second)
 	if err == nil {
 		return
 	}
@@ -109,10 +214,61 @@ func Stop(homedir string) {
 	process.Signal(os.Kill)
 }
 
+func pingCPI(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	err := c1.Ping(ctx, cpiAddr)
+	if err != nil {
+		return &CallError{Kind: ErrCPIUnreachable, Err: err}
+	}
+
+	return nil
+}
+
+func pingVPNKit(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	err := c2.Ping(ctx, vpnkitAddr)
+	if err != nil {
+		return &CallError{Kind: ErrVPNKitUnreachable, Err: err}
+	}
+
+	return nil
+}
+
+// callVPNKit makes a call to the vpnkit-manager within the timeout
+func callVPNKit(ctx context.Context, call func(context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	err := call(callCtx)
+	if err != nil {
+		return classify(ctx, err, pingVPNKit)
+	}
+
+	return nil
+}
+
+// classify tells a service that cannot be reached, as
+// found out by pinging it, from one that refused the call
+func classify(ctx context.Context, err error, ping func(context.Context) error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if pingErr := ping(ctx); pingErr != nil {
+		return &CallError{Kind: pingErr.(*CallError).Kind, Err: err}
+	}
+
+	return err
+}
+
 func fetchVMProcess(homedir string) (*os.Process, bool) {
 	pidFile := path.Pidpath(homedir)
 
-	_, err := os.Stat(pidFile)
+	info, err := os.Stat(pidFile)
 	if os.IsNotExist(err) {
 		return nil, false
 	}
@@ -126,7 +282,7 @@ func fetchVMProcess(homedir string) (*os.Process, bool) {
 		return nil, false
 	}
 
-	pid, err := strconv.Atoi(string(data))
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
 	if err != nil {
 		return nil, false
 	}
@@ -141,5 +297,9 @@ func fetchVMProcess(homedir string) (*os.Process, bool) {
 		return nil, false
 	}
 
+	if !isHypervisor(pid, path.LinuxkitStatePath(homedir), info.ModTime()) {
+		return nil, false
+	}
+
 	return process, true
 }
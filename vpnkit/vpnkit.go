@@ -0,0 +1,318 @@
+// Package vpnkit controls the port forwards of the vpnkit process that
+// networks the VM. vpnkit serves them as a 9P file system on its port
+// socket, where every forward is a directory of the root named after
+// it, and removing the directory takes the forward down.
+package vpnkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	msize   = 8192
+	noTag   = 0xffff
+	noFid   = 0xffffffff
+	rootFid = 1
+	dirFid  = 2
+
+	tversion = 100
+	tattach  = 104
+	rerror   = 107
+	twalk    = 110
+	topen    = 112
+	tread    = 116
+	tclunk   = 120
+	tremove  = 122
+
+	oread = 0
+)
+
+// Name returns the name that vpnkit gives the forward of the given
+// host address to the given address of the VM, in which IPv6
+// addresses are enclosed in brackets
+func Name(protocol string, hostIP string, hostPort int, containerIP string, containerPort int) string {
+	return fmt.Sprintf("%s:%s:%s:%s", protocol,
+		net.JoinHostPort(hostIP, strconv.Itoa(hostPort)), protocol,
+		net.JoinHostPort(containerIP, strconv.Itoa(containerPort)))
+}
+
+// List returns the names of every forward of vpnkit
+func List(ctx context.Context, socket string) ([]string, error) {
+	c, err := dial(ctx, socket)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	return c.list()
+}
+
+// Remove takes down the forwards with the given names,
+// skipping those that vpnkit does not have
+func Remove(ctx context.Context, socket string, names []string) error {
+	c, err := dial(ctx, socket)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	forwards, err := c.list()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !contains(forwards, name) {
+			continue
+		}
+
+		err = c.remove(name)
+		if err != nil {
+			return fmt.Errorf("failed to remove forward %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+type client struct {
+	conn net.Conn
+	tag  uint16
+}
+
+func dial(ctx context.Context, socket string) (*client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &client{conn: conn}
+
+	_, err = c.call(tversion, u32(msize), str("9P2000"))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to negotiate with vpnkit: %s", err)
+	}
+
+	_, err = c.call(tattach, u32(rootFid), u32(noFid), str("blt"), str(""))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to attach to vpnkit: %s", err)
+	}
+
+	return c, nil
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// list reads the entries of the root directory
+func (c *client) list() ([]string, error) {
+	_, err := c.call(twalk, u32(rootFid), u32(dirFid), u16(0))
+	if err != nil {
+		return nil, err
+	}
+	defer c.call(tclunk, u32(dirFid))
+
+	_, err = c.call(topen, u32(dirFid), []byte{oread})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		names  []string
+		offset uint64
+	)
+
+	for {
+		reply, err := c.call(tread, u32(dirFid), u64(offset), u32(msize-11))
+		if err != nil {
+			return nil, err
+		}
+
+		d := &decoder{data: reply}
+		data := d.bytes(int(d.u32()))
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		if len(data) == 0 {
+			return names, nil
+		}
+
+		offset += uint64(len(data))
+
+		entries := &decoder{data: data}
+		for len(entries.data) > 0 && entries.err == nil {
+			stat := &decoder{data: entries.bytes(int(entries.u16()))}
+
+			// type, dev, qid, mode, atime, mtime and length come before the name
+			stat.bytes(2 + 4 + 13 + 4 + 4 + 4 + 8)
+			names = append(names, stat.str())
+
+			if stat.err != nil {
+				return nil, stat.err
+			}
+		}
+
+		if entries.err != nil {
+			return nil, entries.err
+		}
+	}
+}
+
+func (c *client) remove(name string) error {
+	_, err := c.call(twalk, u32(rootFid), u32(dirFid), u16(1), str(name))
+	if err != nil {
+		return err
+	}
+
+	// the fid is clunked by the remove, even when it fails
+	_, err = c.call(tremove, u32(dirFid))
+	return err
+}
+
+// call sends a message and returns the body of the reply
+func (c *client) call(kind byte, fields ...[]byte) ([]byte, error) {
+	tag := uint16(noTag)
+	if kind != tversion {
+		c.tag++
+		tag = c.tag
+	}
+
+	body := bytes.Join(fields, nil)
+
+	var message bytes.Buffer
+	message.Write(u32(uint32(4 + 1 + 2 + len(body))))
+	message.WriteByte(kind)
+	message.Write(u16(tag))
+	message.Write(body)
+
+	_, err := c.conn.Write(message.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	_, err = io.ReadFull(c.conn, header)
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size < 7 || size > msize {
+		return nil, fmt.Errorf("reply of unexpected size %d", size)
+	}
+
+	reply := make([]byte, size-7)
+	_, err = io.ReadFull(c.conn, reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if got := binary.LittleEndian.Uint16(header[5:7]); got != tag {
+		return nil, fmt.Errorf("reply to tag %d where %d was expected", got, tag)
+	}
+
+	switch header[4] {
+	case kind + 1:
+		return reply, nil
+	case rerror:
+		d := &decoder{data: reply}
+		message := d.str()
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		return nil, errors.New(message)
+	default:
+		return nil, fmt.Errorf("reply of unexpected type %d", header[4])
+	}
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n > len(d.data) {
+		d.err = errors.New("reply is too short")
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) u16() uint16 {
+	b := d.bytes(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *decoder) u32() uint32 {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) str() string {
+	return string(d.bytes(int(d.u16())))
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func str(s string) []byte {
+	return append(u16(uint16(len(s))), s...)
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,183 @@
+package vpnkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestListAndRemove(t *testing.T) {
+	tcp := Name("tcp", "10.0.0.5", 80, "10.0.0.5", 80)
+	udp := Name("udp", "10.0.0.5", 514, "10.0.0.5", 514)
+
+	server := &fakeServer{forwards: map[string]bool{tcp: true, udp: true}}
+	socket := server.start(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	names, err := List(ctx, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{tcp, udp}) {
+		t.Fatalf("expected %v, got %v", []string{tcp, udp}, names)
+	}
+
+	err = Remove(ctx, socket, []string{tcp, Name("tcp", "10.0.0.6", 80, "10.0.0.6", 80)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = List(ctx, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(names, []string{udp}) {
+		t.Fatalf("expected %v, got %v", []string{udp}, names)
+	}
+}
+
+func TestName(t *testing.T) {
+	name := Name("tcp", "127.0.0.1", 8080, "10.0.0.5", 80)
+	if name != "tcp:127.0.0.1:8080:tcp:10.0.0.5:80" {
+		t.Fatalf("unexpected name %s", name)
+	}
+
+	name = Name("udp", "::1", 514, "fd00::5", 514)
+	if name != "udp:[::1]:514:udp:[fd00::5]:514" {
+		t.Fatalf("unexpected name %s", name)
+	}
+}
+
+// fakeServer serves forwards the way vpnkit does, for the
+// messages that the client sends, over a unix socket
+type fakeServer struct {
+	forwards map[string]bool
+	fids     map[uint32]string
+}
+
+func (s *fakeServer) start(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vpnkit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "vpnkit_port.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		l.Close()
+		os.RemoveAll(dir)
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.serve(conn)
+		}
+	}()
+
+	return socket
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.fids = map[uint32]string{}
+
+	for {
+		header := make([]byte, 7)
+		_, err := io.ReadFull(conn, header)
+		if err != nil {
+			return
+		}
+
+		body := make([]byte, binary.LittleEndian.Uint32(header)-7)
+		_, err = io.ReadFull(conn, body)
+		if err != nil {
+			return
+		}
+
+		d := &decoder{data: body}
+		kind, tag := header[4], binary.LittleEndian.Uint16(header[5:])
+
+		var reply []byte
+		switch kind {
+		case tversion:
+			reply = append(u32(msize), str("9P2000")...)
+		case tattach:
+			s.fids[d.u32()] = ""
+			reply = make([]byte, 13)
+		case twalk:
+			fid, newfid, n := d.u32(), d.u32(), d.u16()
+			name := s.fids[fid]
+			if n == 1 {
+				name = d.str()
+				if !s.forwards[name] {
+					s.reply(conn, rerror, tag, str("No such file or directory"))
+					continue
+				}
+			}
+
+			s.fids[newfid] = name
+			reply = append(u16(n), make([]byte, 13*int(n))...)
+		case topen:
+			reply = make([]byte, 13+4)
+		case tread:
+			fid, offset := d.u32(), d.u32()
+			var data []byte
+			if s.fids[fid] == "" && offset == 0 {
+				data = s.entries()
+			}
+
+			reply = append(u32(uint32(len(data))), data...)
+		case tremove:
+			fid := d.u32()
+			delete(s.forwards, s.fids[fid])
+			delete(s.fids, fid)
+		case tclunk:
+			delete(s.fids, d.u32())
+		}
+
+		s.reply(conn, kind+1, tag, reply)
+	}
+}
+
+func (s *fakeServer) entries() []byte {
+	var data bytes.Buffer
+	for name := range s.forwards {
+		stat := append(make([]byte, 2+4+13+4+4+4+8), str(name)...)
+		stat = append(stat, bytes.Repeat(str(""), 3)...)
+
+		data.Write(u16(uint16(len(stat))))
+		data.Write(stat)
+	}
+
+	return data.Bytes()
+}
+
+func (s *fakeServer) reply(conn net.Conn, kind byte, tag uint16, body []byte) {
+	conn.Write(u32(uint32(7 + len(body))))
+	conn.Write([]byte{kind})
+	conn.Write(u16(tag))
+	conn.Write(body)
+}
@@ -43,6 +43,16 @@ func DownloadAssets(version string, homedir string, messageChan chan string) err
 	return unpackAsset(assetPath, homedir)
 }
 
+// Download fetches the given url into a temporary file, validating
+// it against a sha1 checksum when one is provided
+func Download(url string, sha string, messageChan chan string) (string, error) {
+	if sha == "" {
+		return fetch(url, messageChan)
+	}
+
+	return fetch(url, messageChan, sha)
+}
+
 func unpackAsset(src string, homedir string) error {
 	output, err := exec.Command("tar", "xf", src, "-C", homedir).CombinedOutput()
 	if err != nil {